@@ -0,0 +1,214 @@
+// kafka-probe checks Kafka broker running in the same container, operator copies it into broker pods
+// by init container and uses it as readiness and liveness probe.
+//
+//	kafka-probe readiness - broker is registered in cluster and it is in sync for all its partitions
+//	kafka-probe liveness  - Kafka process is running
+//	kafka-probe shutdown  - preStop hook, starts controlled shutdown and waits until broker leads no partition
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka"
+	"github.com/spf13/pflag"
+)
+
+// kafkaMainClasses are main classes of Apache Kafka and of Confluent images
+var kafkaMainClasses = []string{"kafka.Kafka", "io.confluent.support.metrics.SupportedKafka"}
+
+func main() {
+	address := pflag.String("address", "localhost:9092", "Address of local broker")
+	timeout := pflag.Duration("timeout", 4*time.Second, "Timeout of request to broker")
+	logDirs := pflag.String("log-dirs", os.Getenv("KAFKA_LOG_DIRS"), "Log directories of broker, broker ID is read from meta.properties")
+	shutdownTimeout := pflag.Duration("shutdown-timeout", 50*time.Second, "Maximum time of waiting for controlled shutdown")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s readiness|liveness|shutdown [flags]\n", os.Args[0])
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	var err error
+	switch pflag.Arg(0) {
+	case "readiness":
+		err = checkReadiness(*address, *timeout, *logDirs)
+	case "liveness":
+		err = checkLiveness()
+	case "shutdown":
+		err = shutdown(*address, *timeout, *logDirs, *shutdownTimeout)
+	default:
+		pflag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// checkReadiness requests metadata from local broker and checks broker is registered and in sync
+func checkReadiness(address string, timeout time.Duration, logDirs string) error {
+	brokerID, err := getBrokerID(logDirs)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := kafka.Dial(ctx, address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	metadata, err := conn.Metadata()
+	if err != nil {
+		return err
+	}
+
+	if !metadata.HasBroker(brokerID) {
+		return fmt.Errorf("broker %d is not registered in cluster", brokerID)
+	}
+	// Partitions without leader cannot be caught up, they are reported by health checks of operator
+	outOfSync := 0
+	for _, topic := range metadata.Topics {
+		for _, partition := range topic.Partitions {
+			if partition.IsReplica(brokerID) && !partition.IsOffline() && !partition.IsInSync(brokerID) {
+				outOfSync++
+			}
+		}
+	}
+	if outOfSync > 0 {
+		return fmt.Errorf("broker %d is not in sync for %d partitions", brokerID, outOfSync)
+	}
+	return nil
+}
+
+// getBrokerID returns broker.id or node.id from meta.properties of first log directory
+func getBrokerID(logDirs string) (int32, error) {
+	if len(logDirs) == 0 {
+		return 0, fmt.Errorf("log directories are not set")
+	}
+	path := filepath.Join(strings.Split(logDirs, ",")[0], "meta.properties")
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for _, key := range []string{"broker.id=", "node.id="} {
+			if strings.HasPrefix(line, key) {
+				id, err := strconv.ParseInt(strings.TrimPrefix(line, key), 10, 32)
+				if err != nil {
+					return 0, fmt.Errorf("invalid broker ID in %s: %v", path, err)
+				}
+				return int32(id), nil
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("broker ID is not found in %s", path)
+}
+
+// checkLiveness looks for Kafka process, so broker is alive also during long log recovery
+func checkLiveness() error {
+	pid, err := findKafkaProcess()
+	if err != nil {
+		return err
+	}
+	if pid == 0 {
+		return fmt.Errorf("kafka process is not running")
+	}
+	return nil
+}
+
+// shutdown sends SIGTERM to Kafka process, so broker does controlled shutdown and controller moves leadership
+// of its partitions to other brokers, it returns when broker leads no partition or process exits
+func shutdown(address string, timeout time.Duration, logDirs string, shutdownTimeout time.Duration) error {
+	pid, err := findKafkaProcess()
+	if err != nil || pid == 0 {
+		return err
+	}
+	brokerID, err := getBrokerID(logDirs)
+	if err != nil {
+		return err
+	}
+	if err = syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(shutdownTimeout)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(pid, 0) != nil {
+			// Process has exited
+			return nil
+		}
+		// Broker stops listening at the end of shutdown, process is checked until then
+		leaders, err := countLeaders(address, timeout, brokerID)
+		if err == nil && leaders == 0 {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("broker %d did not finish controlled shutdown in %s", brokerID, shutdownTimeout)
+}
+
+// countLeaders returns number of partitions led by broker
+func countLeaders(address string, timeout time.Duration, brokerID int32) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := kafka.Dial(ctx, address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	metadata, err := conn.Metadata()
+	if err != nil {
+		return 0, err
+	}
+
+	leaders := 0
+	for _, topic := range metadata.Topics {
+		for _, partition := range topic.Partitions {
+			if partition.Leader == brokerID {
+				leaders++
+			}
+		}
+	}
+	return leaders, nil
+}
+
+// findKafkaProcess returns PID of Kafka process or 0 when it is not running
+func findKafkaProcess() (int, error) {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		return 0, err
+	}
+	for _, cmdline := range cmdlines {
+		data, err := ioutil.ReadFile(cmdline)
+		if err != nil {
+			// Process has exited
+			continue
+		}
+		for _, arg := range strings.Split(string(data), "\x00") {
+			for _, class := range kafkaMainClasses {
+				if arg == class {
+					return strconv.Atoi(filepath.Base(filepath.Dir(cmdline)))
+				}
+			}
+		}
+	}
+	return 0, nil
+}
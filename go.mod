@@ -1,8 +1,10 @@
 module github.com/Svimba/lite-kafka-operator
 
 require (
+	github.com/coreos/prometheus-operator v0.29.0
 	github.com/go-logr/logr v0.1.0
 	github.com/operator-framework/operator-sdk v0.9.1-0.20190718224406-f5d20c4819b9
+	github.com/samuel/go-zookeeper v0.0.0-20190923202752-2cc03de413da
 	github.com/spf13/pflag v1.0.3
 	k8s.io/api v0.0.0-20190612125737-db0771252981
 	k8s.io/apimachinery v0.0.0-20190612125636-6a5db36e93ad
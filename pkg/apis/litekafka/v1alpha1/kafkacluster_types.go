@@ -1,7 +1,12 @@
 package v1alpha1
 
 import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // Port defines the desired state of Port
@@ -16,6 +21,46 @@ type Port struct {
 type ZookeeperSpec struct {
 	Host string `json:"host"`
 	Port *Port  `json:"port"`
+	// Servers is a list of host:port of ensemble members, Host and Port are used when it is empty
+	Servers []string `json:"servers,omitempty"`
+	// Chroot is a znode path used as root of Kafka data, e.g. /kafka/prod-a
+	Chroot string             `json:"chroot,omitempty"`
+	TLS    *ZookeeperTLSSpec  `json:"tls,omitempty"`
+	SASL   *ZookeeperSASLSpec `json:"sasl,omitempty"`
+	// Managed makes operator deploy ZooKeeper ensemble of cluster, Host and Servers are ignored,
+	// TLS and SASL are not supported by managed ensemble
+	Managed  bool   `json:"managed,omitempty"`
+	Replicas int32  `json:"replicas,omitempty"`
+	Image    string `json:"image,omitempty"`
+	Storage  string `json:"storage,omitempty"`
+}
+
+// ZookeeperTLSSpec defines TLS connection to ZooKeeper
+// +k8s:openapi-gen=true
+type ZookeeperTLSSpec struct {
+	// SecretName is a secret with ca.crt, tls.crt and tls.key used by operator,
+	// and keystore.p12, truststore.p12 and password used by brokers
+	SecretName string `json:"secretName"`
+}
+
+// ZookeeperSASLSpec defines SASL Digest authentication to ZooKeeper
+// +k8s:openapi-gen=true
+type ZookeeperSASLSpec struct {
+	// SecretName is a secret with username and password keys
+	SecretName string `json:"secretName"`
+}
+
+// GetServers returns list of host:port of ZooKeeper servers
+func (zs *ZookeeperSpec) GetServers() []string {
+	if len(zs.Servers) > 0 {
+		return zs.Servers
+	}
+	return []string{fmt.Sprintf("%s:%d", zs.Host, zs.Port.Port)}
+}
+
+// GetConnectString returns ZooKeeper connect string with chroot
+func (zs *ZookeeperSpec) GetConnectString() string {
+	return strings.Join(zs.GetServers(), ",") + zs.Chroot
 }
 
 // KafkaOptions defines the desired state of KafkaOptions
@@ -25,25 +70,286 @@ type KafkaOptions struct {
 	JXMPort                uint `json:"jxmport"`
 }
 
+// PodTemplate defines scheduling options of broker pods, topologySpreadConstraints are not supported
+// because the pinned Kubernetes API (1.13) does not have them, Affinity has to be used to spread brokers
+// +k8s:openapi-gen=true
+type PodTemplate struct {
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
+	Affinity          *corev1.Affinity    `json:"affinity,omitempty"`
+	PriorityClassName string              `json:"priorityClassName,omitempty"`
+}
+
+// KafkaTemplate defines the desired state of KafkaTemplate
+// +k8s:openapi-gen=true
+type KafkaTemplate struct {
+	Pod *PodTemplate `json:"pod,omitempty"`
+}
+
+// RackSpec defines the desired state of RackSpec
+// +k8s:openapi-gen=true
+type RackSpec struct {
+	// TopologyKey is a node label used as broker.rack, e.g. failure-domain.beta.kubernetes.io/zone
+	// (topology.kubernetes.io/zone since Kubernetes 1.17), broker does not start until its node has the label
+	TopologyKey string `json:"topologyKey"`
+}
+
+// DisruptionBudgetSpec defines the desired state of PodDisruptionBudget of brokers
+// +k8s:openapi-gen=true
+type DisruptionBudgetSpec struct {
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// MetricsSpec defines Prometheus JMX exporter of brokers
+// +k8s:openapi-gen=true
+type MetricsSpec struct {
+	// Mode is sidecar (default) or javaagent, in javaagent mode Image has to contain
+	// jmx_prometheus_javaagent jar, which is copied into broker by init container
+	Mode  string `json:"mode,omitempty"`
+	Image string `json:"image,omitempty"`
+	// JarPath defaults to jmx_prometheus_httpserver.jar in sidecar mode and to
+	// jmx_prometheus_javaagent.jar in javaagent mode
+	JarPath string `json:"jarPath,omitempty"`
+	Port    *Port  `json:"port,omitempty"`
+	// ConfigMapName is a ConfigMap with exporter configuration in config.yml key,
+	// operator manages ConfigMap with default rules when it is empty
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// MonitorLabels are added to ServiceMonitor and PrometheusRule, so Prometheus can select them
+	MonitorLabels map[string]string `json:"monitorLabels,omitempty"`
+}
+
+// Metrics exporter modes
+const (
+	MetricsModeSidecar   = "sidecar"
+	MetricsModeJavaAgent = "javaagent"
+)
+
+// Cluster modes
+const (
+	ModeZookeeper = "zookeeper"
+	ModeKRaft     = "kraft"
+)
+
+// KRaftSpec defines the desired state of KRaft controller quorum
+// +k8s:openapi-gen=true
+type KRaftSpec struct {
+	// ControllerReplicas runs dedicated controller pods when set, otherwise brokers are also controllers,
+	// it cannot be changed after quorum is formed, voters of static quorum are recorded in status
+	ControllerReplicas int32  `json:"controllerReplicas,omitempty"`
+	ControllerPort     *Port  `json:"controllerPort,omitempty"`
+	ControllerStorage  string `json:"controllerStorage,omitempty"`
+}
+
+// DeletionSpec defines cleanup done by operator before KafkaCluster is deleted, teardown of paused cluster
+// waits until reconcile is resumed. Operator creates no resources outside of Kubernetes (e.g. per-broker
+// LoadBalancers), everything else it creates is owned by KafkaCluster and garbage collected
+// +k8s:openapi-gen=true
+type DeletionSpec struct {
+	// DeleteZookeeperData deletes all znodes under spec.zookeeper.chroot, so cluster of the same name
+	// can be created again, data are never deleted when chroot is not set
+	DeleteZookeeperData bool `json:"deleteZookeeperData,omitempty"`
+	// PersistentVolumeClaims is Retain (default) or Delete, claims of StatefulSets are not garbage collected
+	PersistentVolumeClaims string `json:"persistentVolumeClaims,omitempty"`
+}
+
+// Retention policies of PersistentVolumeClaims
+const (
+	PersistentVolumeClaimsRetain = "Retain"
+	PersistentVolumeClaimsDelete = "Delete"
+)
+
 // KafkaClusterSpec defines the desired state of KafkaCluster
 // +k8s:openapi-gen=true
 type KafkaClusterSpec struct {
-	Replicas       int32          `json:"replicas"`
-	ContainerPort  *Port          `json:"containerPort"`
-	ServicePort    *Port          `json:"servicePort"`
-	Storage        string         `json:"storage"`
-	Options        *KafkaOptions  `json:"options"`
-	Zookeeper      *ZookeeperSpec `json:"zookeeper"`
-	ZookeeperCheck *bool          `json:"zookeeperCheck"`
-	Image          string         `json:"image"`
+	Replicas         int32                 `json:"replicas"`
+	ContainerPort    *Port                 `json:"containerPort"`
+	ServicePort      *Port                 `json:"servicePort"`
+	Storage          string                `json:"storage"`
+	Options          *KafkaOptions         `json:"options"`
+	Zookeeper        *ZookeeperSpec        `json:"zookeeper"`
+	ZookeeperCheck   *bool                 `json:"zookeeperCheck"`
+	Image            string                `json:"image"`
+	Template         *KafkaTemplate        `json:"template,omitempty"`
+	Rack             *RackSpec             `json:"rack,omitempty"`
+	DisruptionBudget *DisruptionBudgetSpec `json:"disruptionBudget,omitempty"`
+	// Mode is zookeeper (default) or kraft, changing zookeeper to kraft migrates running cluster,
+	// migration requires dedicated controllers, images supporting migration (cp-kafka 7.4+)
+	// and inter.broker.protocol.version 3.4 or higher
+	Mode     string        `json:"mode,omitempty"`
+	KRaft    *KRaftSpec    `json:"kraft,omitempty"`
+	Metrics  *MetricsSpec  `json:"metrics,omitempty"`
+	Deletion *DeletionSpec `json:"deletion,omitempty"`
+	// BrokerIDOffset is added to ordinal of broker pod to get ID of new broker, operator keeps IDs of pods
+	// in ConfigMap <name>-kafka-broker-ids, so broker keeps its ID when it is replaced and ID of pod can be
+	// changed there, it is not used by brokers which are also KRaft controllers. IDs have to be 1000
+	// (reserved.broker.max.id) or lower while brokers are registered in zookeeper and below 9000 in KRaft mode,
+	// IDs of dedicated controllers start there, spec giving higher IDs is rejected. IDs are kept by pod name
+	// like volumes of StatefulSet, so pod scaled down and up again gets its ID back, entry of pod has to be
+	// removed from ConfigMap to give it a new ID, e.g. after its volume is deleted. Scaling down always removes
+	// brokers with the highest ordinals, broker in the middle cannot be decommissioned, its pod can only be
+	// replaced by a new broker with the same ordinal
+	BrokerIDOffset int32 `json:"brokerIdOffset,omitempty"`
+	// TerminationGracePeriodSeconds of brokers and controllers, it has to be long enough for controlled shutdown
+	// to move leadership of all partitions of broker, otherwise broker is killed and recovers logs on restart
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+	// Paused stops operator from changing resources of cluster, status is still updated and rack is still
+	// set on restarted broker pods, the same is done by PausedAnnotation set to "true"
+	Paused bool `json:"paused,omitempty"`
+}
+
+// PausedAnnotation set to "true" pauses reconcile of cluster without change of spec
+const PausedAnnotation = "litekafka.operator.mirantis.com/paused"
+
+// ConditionType is a type of KafkaCluster condition
+type ConditionType string
+
+// KafkaCluster condition types
+const (
+	ConditionZookeeperReady ConditionType = "ZookeeperReady"
+	ConditionMigrating      ConditionType = "Migrating"
+	ConditionHealthy        ConditionType = "Healthy"
+	ConditionPaused         ConditionType = "Paused"
+	// ConditionSpecValid is False while spec cannot be applied to cluster, reconcile waits until it is fixed
+	ConditionSpecValid ConditionType = "SpecValid"
+)
+
+// MigrationPhase is a phase of migration from ZooKeeper to KRaft
+type MigrationPhase string
+
+// Phases of migration from ZooKeeper to KRaft, rollback is possible before Finalizing
+const (
+	// MigrationPhaseControllers deploys KRaft controllers with migration enabled
+	MigrationPhaseControllers MigrationPhase = "DeployingControllers"
+	// MigrationPhaseBrokersMigration rolls brokers with migration flags, controllers copy metadata from ZooKeeper
+	MigrationPhaseBrokersMigration MigrationPhase = "MigratingBrokers"
+	// MigrationPhaseBrokersKRaft rolls brokers in KRaft mode, controllers still write metadata to ZooKeeper
+	MigrationPhaseBrokersKRaft MigrationPhase = "RollingBrokersToKRaft"
+	// MigrationPhaseFinalizing rolls controllers without migration, ZooKeeper is not used anymore
+	MigrationPhaseFinalizing MigrationPhase = "Finalizing"
+	// MigrationPhaseRollingBackBrokers rolls brokers from KRaft mode back to migration mode
+	MigrationPhaseRollingBackBrokers MigrationPhase = "RollingBackBrokers"
+	// MigrationPhaseRollingBack rolls brokers back to ZooKeeper mode and removes controllers
+	MigrationPhaseRollingBack MigrationPhase = "RollingBack"
+)
+
+// MigrationStatus defines the observed state of migration from ZooKeeper to KRaft
+// +k8s:openapi-gen=true
+type MigrationStatus struct {
+	Phase              MigrationPhase `json:"phase"`
+	LastTransitionTime metav1.Time    `json:"lastTransitionTime,omitempty"`
+}
+
+// KRaftStatus defines static quorum of KRaft controllers, it is recorded when quorum is formed
+// because controller.quorum.voters cannot change while the cluster runs
+// +k8s:openapi-gen=true
+type KRaftStatus struct {
+	// ControllerReplicas is a number of dedicated controllers, brokers are also controllers when it is 0
+	ControllerReplicas int32 `json:"controllerReplicas,omitempty"`
+	// Voters is a number of controllers in quorum
+	Voters int32 `json:"voters"`
+}
+
+// HealthStatus defines state of cluster reported by brokers
+// +k8s:openapi-gen=true
+type HealthStatus struct {
+	// ControllerID is an active controller reported by brokers, -1 when there is none
+	ControllerID int32 `json:"controllerID"`
+	// Brokers are IDs of brokers registered in cluster
+	Brokers                   []int32 `json:"brokers,omitempty"`
+	OfflinePartitions         int32   `json:"offlinePartitions"`
+	UnderReplicatedPartitions int32   `json:"underReplicatedPartitions"`
+	// ControlledShutdownDisabled are IDs of brokers with controlled.shutdown.enable=false
+	ControlledShutdownDisabled []int32 `json:"controlledShutdownDisabled,omitempty"`
+}
+
+// Condition defines an observation of KafkaCluster state
+// +k8s:openapi-gen=true
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// ZookeeperServerStatus defines the observed state of a single ZooKeeper server
+// +k8s:openapi-gen=true
+type ZookeeperServerStatus struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode,omitempty"`
+	Serving bool   `json:"serving"`
+	Error   string `json:"error,omitempty"`
 }
 
 // KafkaClusterStatus defines the observed state of KafkaCluster
 // +k8s:openapi-gen=true
 type KafkaClusterStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+	Conditions       []Condition             `json:"conditions,omitempty"`
+	ZookeeperServers []ZookeeperServerStatus `json:"zookeeperServers,omitempty"`
+	// ZookeeperChroot is a chroot znode created by operator
+	ZookeeperChroot string `json:"zookeeperChroot,omitempty"`
+	// ClusterID is generated by operator and used to format storage in KRaft mode
+	ClusterID string `json:"clusterID,omitempty"`
+	// Mode is a mode cluster runs in, it differs from spec during migration
+	Mode string `json:"mode,omitempty"`
+	// KRaft is a quorum of KRaft controllers, it is set with ClusterID
+	KRaft *KRaftStatus `json:"kraft,omitempty"`
+	// Migration is set while cluster migrates from ZooKeeper to KRaft
+	Migration *MigrationStatus `json:"migration,omitempty"`
+	// Health is a state of cluster collected by periodic health check of operator
+	Health *HealthStatus `json:"health,omitempty"`
+}
+
+// GetCondition returns condition of given type or nil
+func (s *KafkaClusterStatus) GetCondition(conditionType ConditionType) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates condition, transition time is changed only when status changes
+func (s *KafkaClusterStatus) SetCondition(conditionType ConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, Condition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.Status = status
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true if condition of given type exists and is True
+func (s *KafkaClusterStatus) IsConditionTrue(conditionType ConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// SetMigrationPhase moves migration to given phase
+func (s *KafkaClusterStatus) SetMigrationPhase(phase MigrationPhase) {
+	if s.Migration == nil {
+		s.Migration = &MigrationStatus{}
+	}
+	if s.Migration.Phase != phase {
+		s.Migration.Phase = phase
+		s.Migration.LastTransitionTime = metav1.Now()
+	}
+}
+
+// GetMigrationPhase returns phase of running migration or empty string
+func (s *KafkaClusterStatus) GetMigrationPhase() MigrationPhase {
+	if s.Migration == nil {
+		return ""
+	}
+	return s.Migration.Phase
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -72,6 +378,11 @@ func init() {
 	SchemeBuilder.Register(&KafkaCluster{}, &KafkaClusterList{})
 }
 
+// IsPaused returns true when reconcile of cluster is paused by spec or annotation
+func (kc *KafkaCluster) IsPaused() bool {
+	return kc.Spec.Paused || kc.Annotations[PausedAnnotation] == "true"
+}
+
 // SetDefaults Set dfault values of KafkaClusterSpec
 func (kc *KafkaCluster) SetDefaults() {
 	if kc.Spec.Replicas == 0 {
@@ -80,8 +391,27 @@ func (kc *KafkaCluster) SetDefaults() {
 	if len(kc.Spec.Storage) == 0 {
 		kc.Spec.Storage = "1Gi"
 	}
+	if len(kc.Spec.Mode) == 0 {
+		kc.Spec.Mode = ModeZookeeper
+	}
 	if len(kc.Spec.Image) == 0 {
-		kc.Spec.Image = "confluentinc/cp-kafka:5.0.1"
+		if kc.Spec.Mode == ModeKRaft {
+			kc.Spec.Image = "confluentinc/cp-kafka:7.4.0"
+		} else {
+			kc.Spec.Image = "confluentinc/cp-kafka:5.0.1"
+		}
+	}
+	// KRaft spec is kept defaulted during rollback of migration
+	if kc.Spec.Mode == ModeKRaft || kc.Spec.KRaft != nil {
+		if kc.Spec.KRaft == nil {
+			kc.Spec.KRaft = &KRaftSpec{}
+		}
+		if kc.Spec.KRaft.ControllerPort == nil {
+			kc.Spec.KRaft.ControllerPort = &Port{Name: "controller", Port: 9093}
+		}
+		if len(kc.Spec.KRaft.ControllerStorage) == 0 {
+			kc.Spec.KRaft.ControllerStorage = "1Gi"
+		}
 	}
 	if kc.Spec.ContainerPort == nil {
 		kc.Spec.ContainerPort = &Port{Name: "kafka", Port: 9092}
@@ -105,6 +435,61 @@ func (kc *KafkaCluster) SetDefaults() {
 		if kc.Spec.Zookeeper.Port == nil {
 			kc.Spec.Zookeeper.Port = &Port{Name: "zookeeper", Port: 2181}
 		}
+		if len(kc.Spec.Zookeeper.Chroot) > 0 {
+			kc.Spec.Zookeeper.Chroot = "/" + strings.Trim(kc.Spec.Zookeeper.Chroot, "/")
+		}
+	}
+	if kc.Spec.Zookeeper.Managed {
+		if kc.Spec.Zookeeper.Replicas == 0 {
+			kc.Spec.Zookeeper.Replicas = 3
+		}
+		if len(kc.Spec.Zookeeper.Image) == 0 {
+			kc.Spec.Zookeeper.Image = "zookeeper:3.5.5"
+		}
+		if len(kc.Spec.Zookeeper.Storage) == 0 {
+			kc.Spec.Zookeeper.Storage = "1Gi"
+		}
+		// Brokers connect to members of managed ensemble
+		kc.Spec.Zookeeper.Servers = []string{}
+		for i := int32(0); i < kc.Spec.Zookeeper.Replicas; i++ {
+			kc.Spec.Zookeeper.Servers = append(kc.Spec.Zookeeper.Servers, fmt.Sprintf("%s-zookeeper-%d.%s-zookeeper-headless.%s.svc:%d",
+				kc.Name, i, kc.Name, kc.Namespace, kc.Spec.Zookeeper.Port.Port))
+		}
+	}
+	if kc.Spec.DisruptionBudget == nil {
+		kc.Spec.DisruptionBudget = &DisruptionBudgetSpec{}
+	}
+	if kc.Spec.DisruptionBudget.MaxUnavailable == nil {
+		maxUnavailable := intstr.FromInt(1)
+		kc.Spec.DisruptionBudget.MaxUnavailable = &maxUnavailable
+	}
+	if kc.Spec.Metrics != nil {
+		if len(kc.Spec.Metrics.Mode) == 0 {
+			kc.Spec.Metrics.Mode = MetricsModeSidecar
+		}
+		if len(kc.Spec.Metrics.Image) == 0 {
+			kc.Spec.Metrics.Image = "bitnami/jmx-exporter:0.12.0"
+		}
+		if len(kc.Spec.Metrics.JarPath) == 0 {
+			// HTTP server jar cannot be loaded by -javaagent
+			kc.Spec.Metrics.JarPath = "/opt/bitnami/jmx-exporter/jmx_prometheus_httpserver.jar"
+			if kc.Spec.Metrics.Mode == MetricsModeJavaAgent {
+				kc.Spec.Metrics.JarPath = "/opt/bitnami/jmx-exporter/jmx_prometheus_javaagent.jar"
+			}
+		}
+		if kc.Spec.Metrics.Port == nil {
+			kc.Spec.Metrics.Port = &Port{Name: "metrics", Port: 9404}
+		}
+	}
+	if kc.Spec.TerminationGracePeriodSeconds == nil {
+		terminationGracePeriodSeconds := int64(60)
+		kc.Spec.TerminationGracePeriodSeconds = &terminationGracePeriodSeconds
+	}
+	if kc.Spec.Deletion == nil {
+		kc.Spec.Deletion = &DeletionSpec{}
+	}
+	if len(kc.Spec.Deletion.PersistentVolumeClaims) == 0 {
+		kc.Spec.Deletion.PersistentVolumeClaims = PersistentVolumeClaimsRetain
 	}
 	if kc.Spec.Options == nil {
 		kc.Spec.Options = &KafkaOptions{
@@ -1,33 +1,105 @@
 package kafkacluster
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"net"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/Svimba/lite-kafka-operator/pkg/zookeeper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-// CheckZookeeperIsReady returns True if zookeeper is ready or False and error
-func CheckZookeeperIsReady(zookeeperHost string, zookeeperPort int32) (bool, error) {
+const zookeeperCheckTimeout = 10 * time.Second
+
+// zookeeperChecker checks servers of zookeeper ensemble, tests replace CheckZookeeperIsReady by fake
+type zookeeperChecker func(ctx context.Context, servers []string, tlsConfig *tls.Config) (*zookeeper.EnsembleStatus, error)
+
+// CheckZookeeperIsReady checks every server of zookeeper ensemble, returns state of ensemble
+// or error if none of servers is reachable. TLS is used when tlsConfig is set.
+func CheckZookeeperIsReady(ctx context.Context, servers []string, tlsConfig *tls.Config) (*zookeeper.EnsembleStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, zookeeperCheckTimeout)
+	defer cancel()
+
+	checker := zookeeper.NewChecker(3*time.Second, 3*time.Second)
+	checker.TLSConfig = tlsConfig
+	ensemble := checker.Check(ctx, servers)
+	return ensemble, ensemble.Error()
+}
+
+// getZookeeperConnectionOptions returns TLS config and credentials of zookeeper from secrets
+func (r *ReconcileKafkaCluster) getZookeeperConnectionOptions(kafka *litekafkav1alpha1.KafkaCluster) (*zookeeper.ConnectionOptions, error) {
+	options := &zookeeper.ConnectionOptions{}
+	zkSpec := kafka.Spec.Zookeeper
 
-	// connect to this socket
-	zooStr := fmt.Sprintf("%s:%d", zookeeperHost, zookeeperPort)
-	conn, err := net.Dial("tcp", zooStr)
-	if err != nil {
-		return false, err
+	if zkSpec.TLS != nil {
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: zkSpec.TLS.SecretName, Namespace: kafka.Namespace}, secret)
+		if err != nil {
+			return nil, err
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(secret.Data["ca.crt"]) {
+			return nil, fmt.Errorf("secret %s does not contain valid ca.crt", secret.Name)
+		}
+		options.TLSConfig = &tls.Config{RootCAs: caPool}
+		if len(secret.Data["tls.crt"]) > 0 {
+			cert, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+			if err != nil {
+				return nil, fmt.Errorf("secret %s does not contain valid tls.crt and tls.key: %v", secret.Name, err)
+			}
+			options.TLSConfig.Certificates = []tls.Certificate{cert}
+		}
 	}
 
-	fmt.Fprintf(conn, "ruok\n")
-	// listen for reply
-	var data []byte
-	data = make([]byte, 4)
-	_, err = bufio.NewReader(conn).Read(data)
-	if err != nil {
-		return false, err
+	if zkSpec.SASL != nil {
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: zkSpec.SASL.SecretName, Namespace: kafka.Namespace}, secret)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret.Data["username"]) == 0 || len(secret.Data["password"]) == 0 {
+			return nil, fmt.Errorf("secret %s does not contain username and password", secret.Name)
+		}
+		options.Username = string(secret.Data["username"])
+		options.Password = string(secret.Data["password"])
 	}
 
-	if string(data) == "imok" {
-		return true, nil
+	return options, nil
+}
+
+// checkZookeeper checks zookeeper ensemble of cluster by zookeeperChecker and writes result into its status
+func (r *ReconcileKafkaCluster) checkZookeeper(kafka *litekafkav1alpha1.KafkaCluster, zkOptions *zookeeper.ConnectionOptions) {
+	start := time.Now()
+	ensemble, _ := r.zookeeperChecker(context.TODO(), kafka.Spec.Zookeeper.GetServers(), zkOptions.TLSConfig)
+	setZookeeperStatus(kafka, ensemble)
+	observeZookeeperCheck(kafka, start, kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionZookeeperReady))
+}
+
+// setZookeeperStatus writes result of zookeeper check into KafkaCluster status
+func setZookeeperStatus(kafka *litekafkav1alpha1.KafkaCluster, ensemble *zookeeper.EnsembleStatus) {
+	servers := []litekafkav1alpha1.ZookeeperServerStatus{}
+	for _, server := range ensemble.Servers {
+		serverStatus := litekafkav1alpha1.ZookeeperServerStatus{
+			Address: server.Address,
+			Mode:    server.Mode,
+			Serving: server.Serving,
+		}
+		if server.Error != nil {
+			serverStatus.Error = server.Error.Error()
+		}
+		servers = append(servers, serverStatus)
 	}
+	kafka.Status.ZookeeperServers = servers
 
-	return false, nil
+	if err := ensemble.Error(); err != nil {
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionZookeeperReady, corev1.ConditionFalse, "Unreachable", err.Error())
+	} else if !ensemble.HasQuorum() {
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionZookeeperReady, corev1.ConditionFalse, "NoQuorum", ensemble.String())
+	} else {
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionZookeeperReady, corev1.ConditionTrue, "QuorumAvailable", ensemble.String())
+	}
 }
@@ -2,102 +2,615 @@ package kafkacluster
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/Svimba/lite-kafka-operator/pkg/zookeeper"
+	monitoringv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-func (r *ReconcileKafkaCluster) handleSTSKafka() (bool, error) {
-	// Define a new object
-	obj := getKafkaStatefulSet(r.kafka)
+// createResource creates resource of cluster and records event about the result
+func (r *ReconcileKafkaCluster) createResource(kafka *litekafkav1alpha1.KafkaCluster, obj runtime.Object, kind, name string) error {
+	if err := r.client.Create(context.TODO(), obj); err != nil {
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "CreateFailed", "Cannot create %s %s: %v", kind, name, err)
+		return err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "Created", "Created %s %s", kind, name)
+	return nil
+}
+
+// updateResource updates resource of cluster and records event with reason and description of change
+func (r *ReconcileKafkaCluster) updateResource(kafka *litekafkav1alpha1.KafkaCluster, obj runtime.Object, kind, name, reason, change string) error {
+	if err := r.client.Update(context.TODO(), obj); err != nil {
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "UpdateFailed", "Cannot update %s %s: %v", kind, name, err)
+		return err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, reason, "%s %s %s: %s", reason, kind, name, change)
+	return nil
+}
+
+// deleteResource deletes resource of cluster, resource which does not exist is not an error and no event is recorded
+func (r *ReconcileKafkaCluster) deleteResource(kafka *litekafkav1alpha1.KafkaCluster, obj runtime.Object, kind, name string) error {
+	err := r.client.Delete(context.TODO(), obj)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "DeleteFailed", "Cannot delete %s %s: %v", kind, name, err)
+		return err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "Deleted", "Deleted %s %s", kind, name)
+	return nil
+}
+
+func (r *ReconcileKafkaCluster) handleSTSKafka(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	return r.handleStatefulSet(kafka, rlog, getKafkaStatefulSet(kafka, r.options.ProbeImage))
+}
+
+func (r *ReconcileKafkaCluster) handleSVCsKafka(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	if err := r.handleService(kafka, rlog, getKafkaServiceHeadless(kafka)); err != nil {
+		return false, err
+	}
+	if err := r.handleService(kafka, rlog, getKafkaService(kafka)); err != nil {
+		return false, err
+	}
+
+	return r.handlePodDisruptionBudget(kafka, rlog, getKafkaPodDisruptionBudget(kafka))
+}
+
+// handleBrokerIDsKafka adds IDs of new broker pods into ConfigMap before the pods are created,
+// IDs changed by user are kept
+func (r *ReconcileKafkaCluster) handleBrokerIDsKafka(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) error {
+	if !hasBrokerIDs(kafka) {
+		return nil
+	}
+	obj := getKafkaBrokerIDsConfigMap(kafka, nil)
+	// Set KafkaCluster instance as the owner and controller
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
+		return err
+	}
+
+	found := &corev1.ConfigMap{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		obj.Data = getBrokerIDs(kafka, nil)
+		rlog.Info("Creating a new ConfigMap", "Namespace", obj.Namespace, "Name", obj.Name)
+		return r.createResource(kafka, obj, "ConfigMap", obj.Name)
+	} else if err != nil {
+		return err
+	}
+
+	brokerIDs := getBrokerIDs(kafka, found.Data)
+	if len(brokerIDs) == len(found.Data) {
+		rlog.Info("Skip reconcile: ConfigMap already exists", "Namespace", found.Namespace, "Name", found.Name)
+		return nil
+	}
+	rlog.Info("Adding IDs of new brokers", "Namespace", found.Namespace, "Name", found.Name)
+	found.Data = brokerIDs
+	return r.updateResource(kafka, found, "ConfigMap", found.Name, "Updated", "IDs of new brokers added")
+}
+
+// handleMetricsKafka deploys Service of JMX exporter and ConfigMap with default rules
+func (r *ReconcileKafkaCluster) handleMetricsKafka(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) error {
+	if kafka.Spec.Metrics == nil {
+		return nil
+	}
+	if len(kafka.Spec.Metrics.ConfigMapName) == 0 {
+		if err := r.handleConfigMap(kafka, rlog, getKafkaMetricsConfigMap(kafka)); err != nil {
+			return err
+		}
+	}
+	return r.handleService(kafka, rlog, getKafkaMetricsService(kafka))
+}
+
+// handleMonitoringKafka deploys ServiceMonitor and PrometheusRule of cluster when prometheus-operator is installed,
+// they are deleted when metrics are disabled
+func (r *ReconcileKafkaCluster) handleMonitoringKafka(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) error {
+	if kafka.Spec.Metrics == nil {
+		metaData := metav1.ObjectMeta{Name: kafka.Name + "-kafka", Namespace: kafka.Namespace}
+		if r.monitoring[monitoringv1.ServiceMonitorsKind] {
+			err := r.deleteResource(kafka, &monitoringv1.ServiceMonitor{ObjectMeta: metaData}, "ServiceMonitor", metaData.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if r.monitoring[monitoringv1.PrometheusRuleKind] {
+			return r.deleteResource(kafka, &monitoringv1.PrometheusRule{ObjectMeta: metaData}, "PrometheusRule", metaData.Name)
+		}
+		return nil
+	}
+
+	if r.monitoring[monitoringv1.ServiceMonitorsKind] {
+		if err := r.handleServiceMonitor(kafka, rlog, getKafkaServiceMonitor(kafka)); err != nil {
+			return err
+		}
+	} else {
+		rlog.Info("Skip reconcile: ServiceMonitor resource is not installed")
+	}
+	if r.monitoring[monitoringv1.PrometheusRuleKind] {
+		return r.handlePrometheusRule(kafka, rlog, getKafkaPrometheusRule(kafka))
+	}
+	rlog.Info("Skip reconcile: PrometheusRule resource is not installed")
+	return nil
+}
+
+// handleServiceMonitor creates ServiceMonitor or updates its spec and labels
+func (r *ReconcileKafkaCluster) handleServiceMonitor(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, obj *monitoringv1.ServiceMonitor) error {
+	// Set KafkaCluster instance as the owner and controller
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
+		return err
+	}
+
+	// Check if this ServiceMonitor already exists
+	found := &monitoringv1.ServiceMonitor{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		rlog.Info("Creating a new ServiceMonitor", "Namespace", obj.Namespace, "Name", obj.Name)
+		return r.createResource(kafka, obj, "ServiceMonitor", obj.Name)
+	} else if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(found.Spec, obj.Spec) && equality.Semantic.DeepEqual(found.Labels, obj.Labels) {
+		rlog.Info("Skip reconcile: ServiceMonitor already exists", "Namespace", found.Namespace, "Name", found.Name)
+		return nil
+	}
+	rlog.Info("Updating ServiceMonitor", "Namespace", obj.Namespace, "Name", obj.Name)
+	found.Spec = obj.Spec
+	found.Labels = obj.Labels
+	return r.updateResource(kafka, found, "ServiceMonitor", found.Name, "Updated", "spec changed")
+}
+
+// handlePrometheusRule creates PrometheusRule or updates its spec and labels
+func (r *ReconcileKafkaCluster) handlePrometheusRule(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, obj *monitoringv1.PrometheusRule) error {
+	// Set KafkaCluster instance as the owner and controller
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
+		return err
+	}
+
+	// Check if this PrometheusRule already exists
+	found := &monitoringv1.PrometheusRule{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		rlog.Info("Creating a new PrometheusRule", "Namespace", obj.Namespace, "Name", obj.Name)
+		return r.createResource(kafka, obj, "PrometheusRule", obj.Name)
+	} else if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(found.Spec, obj.Spec) && equality.Semantic.DeepEqual(found.Labels, obj.Labels) {
+		rlog.Info("Skip reconcile: PrometheusRule already exists", "Namespace", found.Namespace, "Name", found.Name)
+		return nil
+	}
+	rlog.Info("Updating PrometheusRule", "Namespace", obj.Namespace, "Name", obj.Name)
+	found.Spec = obj.Spec
+	found.Labels = obj.Labels
+	return r.updateResource(kafka, found, "PrometheusRule", found.Name, "Updated", "spec changed")
+}
+
+// handleZookeeper deploys managed zookeeper ensemble
+func (r *ReconcileKafkaCluster) handleZookeeper(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	if !kafka.Spec.Zookeeper.Managed {
+		return false, nil
+	}
+	// Managed ensemble listens on plain client port only, brokers configured for TLS or SASL could not connect
+	if kafka.Spec.Zookeeper.TLS != nil || kafka.Spec.Zookeeper.SASL != nil {
+		return false, fmt.Errorf("spec.zookeeper.tls and spec.zookeeper.sasl are not supported by managed Zookeeper")
+	}
+
+	if err := r.handleService(kafka, rlog, getZookeeperServiceHeadless(kafka)); err != nil {
+		return false, err
+	}
+	if err := r.handleService(kafka, rlog, getZookeeperService(kafka)); err != nil {
+		return false, err
+	}
+	requeue, err := r.handlePodDisruptionBudget(kafka, rlog, getZookeeperPodDisruptionBudget(kafka))
+	if err != nil {
+		return requeue, err
+	}
+
+	found := &appsv1.StatefulSet{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: kafka.Name + "-zookeeper", Namespace: kafka.Namespace}, found)
+	if errors.IsNotFound(err) {
+		// New ensemble starts with all members
+		return r.handleStatefulSet(kafka, rlog, getZookeeperStatefulSet(kafka, kafka.Spec.Zookeeper.Replicas))
+	} else if err != nil {
+		return false, err
+	}
+
+	// Members apply changed server list on restart only, so all of them are restarted
+	// before next member is added or removed
+	replicas := *found.Spec.Replicas
+	done, err := r.rollStatefulSetWhen(kafka, rlog, found.Name, func() bool {
+		return r.hasZookeeperQuorum(kafka, rlog, replicas)
+	})
+	if err != nil || !done {
+		return false, err
+	}
+	if replicas < kafka.Spec.Zookeeper.Replicas {
+		replicas++
+	} else if replicas > kafka.Spec.Zookeeper.Replicas {
+		replicas--
+	}
+	return r.handleStatefulSet(kafka, rlog, getZookeeperStatefulSet(kafka, replicas))
+}
+
+// hasZookeeperQuorum returns true when majority of members of managed ensemble serve requests,
+// so one of them can be restarted
+func (r *ReconcileKafkaCluster) hasZookeeperQuorum(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, replicas int32) bool {
+	ensemble, err := r.zookeeperChecker(context.TODO(), getZookeeperMembers(kafka, replicas), nil)
+	if err == nil && ensemble.HasQuorum() {
+		return true
+	}
+	message := ensemble.String()
+	if err != nil {
+		message = err.Error()
+	}
+	rlog.Info("Waiting for quorum of managed Zookeeper before restart of member", "Ensemble", message)
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "WaitingForQuorum", "Waiting for quorum of managed Zookeeper before restart of member: %s", message)
+	return false
+}
+
+// handleKRaft generates cluster ID, records quorum and deploys dedicated KRaft controllers
+func (r *ReconcileKafkaCluster) handleKRaft(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	status := kafka.Status.DeepCopy()
+	if len(kafka.Status.ClusterID) == 0 {
+		clusterID, err := generateClusterID()
+		if err != nil {
+			return false, err
+		}
+		rlog.Info("Generated KRaft cluster ID", "ClusterID", clusterID)
+		r.recorder.Eventf(kafka, corev1.EventTypeNormal, "ClusterIDGenerated", "Generated KRaft cluster ID %s", clusterID)
+		kafka.Status.ClusterID = clusterID
+	}
+	if kafka.Status.KRaft == nil {
+		kafka.Status.KRaft = newKRaftStatus(kafka)
+	}
+	if err := r.updateStatus(kafka, status); err != nil {
+		return true, err
+	}
+
+	if kafka.Spec.KRaft.ControllerReplicas == 0 {
+		return false, nil
+	}
+	if err := r.handleService(kafka, rlog, getKafkaControllerServiceHeadless(kafka)); err != nil {
+		return false, err
+	}
+	return r.handleStatefulSet(kafka, rlog, getKafkaControllerStatefulSet(kafka))
+}
 
+func (r *ReconcileKafkaCluster) handleStatefulSet(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, obj *appsv1.StatefulSet) (bool, error) {
 	// Set KafkaCluster instance as the owner and controller
-	if err := controllerutil.SetControllerReference(r.kafka, obj, r.scheme); err != nil {
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
 		return false, err
 	}
 
-	// Check if this Pod already exists
+	// Check if this StatefulSet already exists
 	found := &appsv1.StatefulSet{}
 	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
-		r.rlog.Info("Creating a new StatefulSet", "Namespace", obj.Namespace, "Name", obj.Name)
-		err = r.client.Create(context.TODO(), obj)
+		rlog.Info("Creating a new StatefulSet", "Namespace", obj.Namespace, "Name", obj.Name)
+		err = r.createResource(kafka, obj, "StatefulSet", obj.Name)
 		if err != nil {
 			return false, err
 		}
-		// Pod created successfully - don't requeue
+		// StatefulSet created successfully - don't requeue
 		return false, nil
 	} else if err != nil {
 		return false, err
 	}
 
-	r.rlog.Info("Check replicas of StatefulSet", "Namespace", obj.Namespace, "Name", obj.Name)
+	rlog.Info("Check replicas of StatefulSet", "Namespace", obj.Namespace, "Name", obj.Name)
+	reason := ""
+	changes := []string{}
 	// Check replicas
 	if *found.Spec.Replicas != *obj.Spec.Replicas {
+		changes = append(changes, fmt.Sprintf("replicas %d -> %d", *found.Spec.Replicas, *obj.Spec.Replicas))
+		reason = "Scaled"
 		found.Spec.Replicas = obj.Spec.Replicas
-		err = r.client.Update(context.TODO(), found)
-		if err != nil {
-			r.rlog.Error(err, "Cannot update number of replicas for StatefulSet")
-			return true, err
+	}
+	// Check pod template, pods pick changes up according to update strategy of StatefulSet
+	if found.Spec.UpdateStrategy.Type != obj.Spec.UpdateStrategy.Type {
+		changes = append(changes, fmt.Sprintf("update strategy %s -> %s", found.Spec.UpdateStrategy.Type, obj.Spec.UpdateStrategy.Type))
+		reason = "Updated"
+		found.Spec.UpdateStrategy = obj.Spec.UpdateStrategy
+	}
+	if found.Annotations[templateHashAnnotation] != obj.Annotations[templateHashAnnotation] {
+		rlog.Info("Pod template of StatefulSet changed", "Namespace", obj.Namespace, "Name", obj.Name)
+		found.Spec.Template = obj.Spec.Template
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
 		}
+		found.Annotations[templateHashAnnotation] = obj.Annotations[templateHashAnnotation]
+		changes = append(changes, "pod template changed")
+		reason = "Updated"
+	}
+	if len(changes) == 0 {
+		// StatefulSet already exists - don't requeue
+		rlog.Info("Skip reconcile: StatefulSet already exists", "Namespace", found.Namespace, "Name", found.Name)
+		return false, nil
+	}
+	rlog.Info("Updating StatefulSet", "Namespace", found.Namespace, "Name", found.Name, "Changes", strings.Join(changes, ", "))
+	err = r.updateResource(kafka, found, "StatefulSet", found.Name, reason, strings.Join(changes, ", "))
+	if err != nil {
+		rlog.Error(err, "Cannot update StatefulSet")
+		return true, err
+	}
+	return false, nil
+}
+
+// rollStatefulSet deletes outdated pods of StatefulSet with OnDelete strategy one by one, highest ordinal first,
+// it returns true when all pods run current revision and are ready
+func (r *ReconcileKafkaCluster) rollStatefulSet(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, name string) (bool, error) {
+	return r.rollStatefulSetWhen(kafka, rlog, name, nil)
+}
 
+// rollStatefulSetWhen rolls StatefulSet as rollStatefulSet, outdated pod is restarted only when canRestart
+// returns true, it is called when all pods are ready
+func (r *ReconcileKafkaCluster) rollStatefulSetWhen(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, name string, canRestart func() bool) (bool, error) {
+	sts := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: kafka.Namespace}, sts)
+	if err != nil {
+		return false, err
+	}
+	if sts.Status.ObservedGeneration < sts.Generation || len(sts.Status.UpdateRevision) == 0 {
+		// Revision of updated template is not known yet
+		return false, nil
 	}
 
-	// Pod already exists - don't requeue
-	r.rlog.Info("Skip reconcile: StatefulSet already exists", "Namespace", found.Namespace, "Name", found.Name)
+	pods := &corev1.PodList{}
+	err = r.client.List(context.TODO(), client.InNamespace(sts.Namespace).MatchingLabels(sts.Spec.Selector.MatchLabels), pods)
+	if err != nil {
+		return false, err
+	}
+	if int32(len(pods.Items)) != *sts.Spec.Replicas {
+		rlog.Info("Waiting for pods of StatefulSet", "Name", sts.Name, "Pods", len(pods.Items), "Replicas", *sts.Spec.Replicas)
+		r.recorder.Eventf(kafka, corev1.EventTypeNormal, "WaitingForPods", "Waiting for %d pods of StatefulSet %s, %d exist",
+			*sts.Spec.Replicas, sts.Name, len(pods.Items))
+		return false, nil
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return getPodOrdinal(&pods.Items[i]) > getPodOrdinal(&pods.Items[j])
+	})
+
+	var outdated *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// Only one pod is restarted at a time
+		if !isPodReady(pod) {
+			rlog.Info("Waiting for pod to be ready", "Namespace", pod.Namespace, "Name", pod.Name)
+			r.recorder.Eventf(kafka, corev1.EventTypeNormal, "WaitingForPod", "Waiting for pod %s to be ready", pod.Name)
+			return false, nil
+		}
+		if outdated == nil && pod.Labels[appsv1.StatefulSetRevisionLabel] != sts.Status.UpdateRevision {
+			outdated = pod
+		}
+	}
+	if outdated == nil {
+		return true, nil
+	}
+	if canRestart != nil && !canRestart() {
+		return false, nil
+	}
+
+	rlog.Info("Restarting pod with outdated revision", "Namespace", outdated.Namespace, "Name", outdated.Name)
+	err = r.client.Delete(context.TODO(), outdated)
+	if err != nil && !errors.IsNotFound(err) {
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "RestartFailed", "Cannot restart pod %s: %v", outdated.Name, err)
+		return false, err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "RestartingPod", "Restarting pod %s to apply revision %s", outdated.Name, sts.Status.UpdateRevision)
 	return false, nil
 }
 
-func (r *ReconcileKafkaCluster) handleSVCsKafka() (bool, error) {
-	// Define a new object
-	objHeadless := getKafkaServiceHeadless(r.kafka)
+// getPodOrdinal returns ordinal of StatefulSet pod from its name
+func getPodOrdinal(pod *corev1.Pod) int {
+	ordinal, err := strconv.Atoi(pod.Name[strings.LastIndex(pod.Name, "-")+1:])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
 
+// isPodReady returns true when pod is ready and it is not terminating
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// handleConfigMap creates ConfigMap or updates its data
+func (r *ReconcileKafkaCluster) handleConfigMap(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, obj *corev1.ConfigMap) error {
 	// Set KafkaCluster instance as the owner and controller
-	if err := controllerutil.SetControllerReference(r.kafka, objHeadless, r.scheme); err != nil {
-		return false, err
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
+		return err
 	}
 
-	// Check if this Service already exists
-	foundHeadless := &corev1.Service{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: objHeadless.Name, Namespace: objHeadless.Namespace}, foundHeadless)
+	// Check if this ConfigMap already exists
+	found := &corev1.ConfigMap{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
-		r.rlog.Info("Creating a new Service", "Namespace", objHeadless.Namespace, "Name", objHeadless.Name)
-		err = r.client.Create(context.TODO(), objHeadless)
-		if err != nil {
-			return false, err
-		}
+		rlog.Info("Creating a new ConfigMap", "Namespace", obj.Namespace, "Name", obj.Name)
+		return r.createResource(kafka, obj, "ConfigMap", obj.Name)
 	} else if err != nil {
-		return false, err
-	} else {
-		// Pod already exists - continue to next svc
-		r.rlog.Info("Skip reconcile: Service already exists", "Namespace", foundHeadless.Namespace, "Name", foundHeadless.Name)
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(found.Data, obj.Data) {
+		rlog.Info("Skip reconcile: ConfigMap already exists", "Namespace", found.Namespace, "Name", found.Name)
+		return nil
 	}
+	rlog.Info("Updating ConfigMap", "Namespace", obj.Namespace, "Name", obj.Name)
+	found.Data = obj.Data
+	return r.updateResource(kafka, found, "ConfigMap", found.Name, "Updated", "data changed")
+}
 
-	// Define a new object
-	obj := getKafkaService(r.kafka)
+func (r *ReconcileKafkaCluster) handleService(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, obj *corev1.Service) error {
 	// Set KafkaCluster instance as the owner and controller
-	if err := controllerutil.SetControllerReference(r.kafka, obj, r.scheme); err != nil {
-		return false, err
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
+		return err
 	}
+
 	// Check if this Service already exists
 	found := &corev1.Service{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
-		r.rlog.Info("Creating a new Service", "Namespace", obj.Namespace, "Name", obj.Name)
-		err = r.client.Create(context.TODO(), obj)
+		rlog.Info("Creating a new Service", "Namespace", obj.Namespace, "Name", obj.Name)
+		return r.createResource(kafka, obj, "Service", obj.Name)
+	} else if err != nil {
+		return err
+	}
+
+	rlog.Info("Skip reconcile: Service already exists", "Namespace", found.Namespace, "Name", found.Name)
+	return nil
+}
+
+func (r *ReconcileKafkaCluster) handlePodDisruptionBudget(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, obj *policyv1beta1.PodDisruptionBudget) (bool, error) {
+	// Set KafkaCluster instance as the owner and controller
+	if err := controllerutil.SetControllerReference(kafka, obj, r.scheme); err != nil {
+		return false, err
+	}
+	// Check if this PodDisruptionBudget already exists
+	found := &policyv1beta1.PodDisruptionBudget{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		rlog.Info("Creating a new PodDisruptionBudget", "Namespace", obj.Namespace, "Name", obj.Name)
+		err = r.createResource(kafka, obj, "PodDisruptionBudget", obj.Name)
 		if err != nil {
 			return false, err
 		}
-
-		// Pod created successfully - don't requeue
 		return false, nil
 	} else if err != nil {
 		return false, err
 	}
-	r.rlog.Info("Skip reconcile: Service already exists", "Namespace", found.Namespace, "Name", found.Name)
+
+	if found.Spec.MaxUnavailable != nil && *found.Spec.MaxUnavailable == *obj.Spec.MaxUnavailable {
+		rlog.Info("Skip reconcile: PodDisruptionBudget already exists", "Namespace", found.Namespace, "Name", found.Name)
+		return false, nil
+	}
+
+	// Spec of PodDisruptionBudget is immutable in policy/v1beta1, so it is recreated
+	rlog.Info("Recreating PodDisruptionBudget", "Namespace", obj.Namespace, "Name", obj.Name, "MaxUnavailable", obj.Spec.MaxUnavailable.String())
+	err = r.client.Delete(context.TODO(), found)
+	if err != nil && !errors.IsNotFound(err) {
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "UpdateFailed", "Cannot delete PodDisruptionBudget %s to recreate it: %v", found.Name, err)
+		return true, err
+	}
+	err = r.client.Create(context.TODO(), obj)
+	if err != nil {
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "UpdateFailed", "Cannot recreate PodDisruptionBudget %s: %v", obj.Name, err)
+		return true, err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "Updated", "Updated PodDisruptionBudget %s: recreated with maxUnavailable %s",
+		obj.Name, obj.Spec.MaxUnavailable.String())
 
 	return false, nil
 }
+
+// handlePodsRack sets rack annotation on broker pods from topology label of their nodes
+func (r *ReconcileKafkaCluster) handlePodsRack(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	if kafka.Spec.Rack == nil {
+		return false, nil
+	}
+
+	pods := &corev1.PodList{}
+	labels := map[string]string{
+		"app.kubernetes.io/component": "kafka-broker",
+		"app.kubernetes.io/name":      "kafka",
+		"app.kubernetes.io/instance":  kafka.Name,
+	}
+	err := r.client.List(context.TODO(), client.InNamespace(kafka.Namespace).MatchingLabels(labels), pods)
+	if err != nil {
+		return false, err
+	}
+
+	annotated := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if _, ok := pod.Annotations[rackAnnotation]; ok {
+			annotated++
+			continue
+		}
+		if len(pod.Spec.NodeName) == 0 {
+			// Pod is not scheduled yet
+			continue
+		}
+
+		node := &corev1.Node{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: pod.Spec.NodeName}, node)
+		if err != nil {
+			return false, err
+		}
+		rack, ok := node.Labels[kafka.Spec.Rack.TopologyKey]
+		if !ok || len(rack) == 0 {
+			// Broker fails to start without rack, it gets rack after node is labeled
+			rlog.Info("Node has no topology label, broker cannot get rack", "Node", node.Name, "TopologyKey", kafka.Spec.Rack.TopologyKey)
+			r.recorder.Eventf(kafka, corev1.EventTypeWarning, "RackMissing", "Node %s of broker pod %s has no label %s, broker waits for rack",
+				node.Name, pod.Name, kafka.Spec.Rack.TopologyKey)
+			continue
+		}
+
+		rlog.Info("Set rack of broker pod", "Namespace", pod.Namespace, "Name", pod.Name, "Rack", rack)
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[rackAnnotation] = rack
+		err = r.client.Update(context.TODO(), pod)
+		if err != nil {
+			r.recorder.Eventf(kafka, corev1.EventTypeWarning, "UpdateFailed", "Cannot set rack of broker pod %s: %v", pod.Name, err)
+			return false, err
+		}
+		r.recorder.Eventf(kafka, corev1.EventTypeNormal, "RackAssigned", "Set rack %q of broker pod %s from node %s", rack, pod.Name, node.Name)
+		annotated++
+	}
+
+	// Pods are created one by one, requeue until all brokers have got rack
+	return annotated < int(kafka.Spec.Replicas), nil
+}
+
+// handleZookeeperChroot creates chroot znode of cluster if it is not created yet
+func (r *ReconcileKafkaCluster) handleZookeeperChroot(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, zkOptions *zookeeper.ConnectionOptions) (bool, error) {
+	chroot := kafka.Spec.Zookeeper.Chroot
+	if len(chroot) == 0 || kafka.Status.ZookeeperChroot == chroot {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 15*time.Second)
+	defer cancel()
+	zkClient, err := r.zookeeperFactory(ctx, kafka.Spec.Zookeeper.GetServers(), zkOptions)
+	if err != nil {
+		return true, err
+	}
+	defer zkClient.Close()
+
+	rlog.Info("Ensure Zookeeper chroot exists", "Chroot", chroot)
+	if err = zkClient.EnsurePath(chroot); err != nil {
+		return true, err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "ChrootCreated", "Zookeeper chroot %s is ready", chroot)
+
+	status := kafka.Status.DeepCopy()
+	kafka.Status.ZookeeperChroot = chroot
+	return false, r.updateStatus(kafka, status)
+}
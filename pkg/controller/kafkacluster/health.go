@@ -0,0 +1,145 @@
+package kafkacluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka"
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka/admin"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// kafkaRequestTimeout limits connection and requests to brokers
+const kafkaRequestTimeout = 10 * time.Second
+
+// reconcileHealth collects state of cluster from brokers into status and schedules next health check
+func (r *ReconcileKafkaCluster) reconcileHealth(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) reconcile.Result {
+	if r.options.HealthCheckInterval <= 0 {
+		return reconcile.Result{}
+	}
+
+	status := kafka.Status.DeepCopy()
+	r.checkHealth(kafka, status, rlog)
+	if err := r.updateStatus(kafka, status); err != nil {
+		rlog.Error(err, "Cannot update status of KafkaCluster")
+	}
+	return reconcile.Result{RequeueAfter: r.options.HealthCheckInterval}
+}
+
+// checkHealth sets health of cluster in status, events are recorded when health differs from previous status
+func (r *ReconcileKafkaCluster) checkHealth(kafka *litekafkav1alpha1.KafkaCluster, status *litekafkav1alpha1.KafkaClusterStatus, rlog logr.Logger) {
+	health, err := r.getClusterHealth(kafka)
+	if err != nil {
+		rlog.Info("Cannot get state of cluster from brokers", "Error", err.Error())
+		kafka.Status.Health = nil
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionHealthy, corev1.ConditionFalse, "Unreachable",
+			fmt.Sprintf("Cannot get metadata from brokers: %v", err))
+	} else {
+		kafka.Status.Health = health
+		setHealthCondition(kafka, health)
+		if len(health.ControlledShutdownDisabled) > 0 && (status.Health == nil ||
+			fmt.Sprint(status.Health.ControlledShutdownDisabled) != fmt.Sprint(health.ControlledShutdownDisabled)) {
+			r.recorder.Eventf(kafka, corev1.EventTypeWarning, "ControlledShutdownDisabled",
+				"Brokers %v have controlled.shutdown.enable=false, they stop without moving leadership of partitions", health.ControlledShutdownDisabled)
+		}
+	}
+	// Event is recorded only when health changes, not on every check
+	previous := status.GetCondition(litekafkav1alpha1.ConditionHealthy)
+	current := kafka.Status.GetCondition(litekafkav1alpha1.ConditionHealthy)
+	if previous == nil || previous.Reason != current.Reason {
+		eventType := corev1.EventTypeWarning
+		if current.Status == corev1.ConditionTrue {
+			eventType = corev1.EventTypeNormal
+		}
+		r.recorder.Event(kafka, eventType, current.Reason, current.Message)
+	}
+}
+
+// getKafkaBootstrapAddress returns address of brokers service of cluster
+func getKafkaBootstrapAddress(kafka *litekafkav1alpha1.KafkaCluster) string {
+	return fmt.Sprintf("%s.%s.svc:%d", getKafkaService(kafka).Name, kafka.Namespace, kafka.Spec.ServicePort.Port)
+}
+
+// getClusterHealth requests metadata from brokers and counts partitions without leader or in sync replicas
+func (r *ReconcileKafkaCluster) getClusterHealth(kafka *litekafkav1alpha1.KafkaCluster) (*litekafkav1alpha1.HealthStatus, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), kafkaRequestTimeout)
+	defer cancel()
+	adminClient, err := r.adminFactory(ctx, getKafkaBootstrapAddress(kafka))
+	if err != nil {
+		return nil, err
+	}
+	defer adminClient.Close()
+	metadata, err := adminClient.DescribeCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	health := &litekafkav1alpha1.HealthStatus{ControllerID: metadata.ControllerID}
+	for _, broker := range metadata.Brokers {
+		health.Brokers = append(health.Brokers, broker.ID)
+	}
+	// Order of brokers differs between responses, status is updated only when it changes
+	sort.Slice(health.Brokers, func(i, j int) bool { return health.Brokers[i] < health.Brokers[j] })
+	for _, topic := range metadata.Topics {
+		for _, partition := range topic.Partitions {
+			if partition.IsOffline() {
+				health.OfflinePartitions++
+			} else if partition.IsUnderReplicated() {
+				health.UnderReplicatedPartitions++
+			}
+		}
+	}
+	if kafka.Status.Mode != litekafkav1alpha1.ModeKRaft {
+		// Brokers in KRaft mode always shut down in controlled way
+		health.ControlledShutdownDisabled = getControlledShutdownDisabled(adminClient, health.Brokers)
+	}
+	return health, nil
+}
+
+// getControlledShutdownDisabled returns brokers which do not move leadership of their partitions before they stop,
+// broker which cannot be asked is checked again by next health check
+func getControlledShutdownDisabled(adminClient admin.Client, brokers []int32) []int32 {
+	disabled := []int32{}
+	for _, broker := range brokers {
+		configs, err := adminClient.DescribeConfigs(kafka.ConfigResource{Type: kafka.ResourceTypeBroker, Name: strconv.Itoa(int(broker))})
+		if err != nil {
+			continue
+		}
+		for _, config := range configs {
+			if config.Name == "controlled.shutdown.enable" && config.Value == "false" {
+				disabled = append(disabled, broker)
+			}
+		}
+	}
+	if len(disabled) == 0 {
+		return nil
+	}
+	return disabled
+}
+
+// setHealthCondition sets Healthy condition by collected state of cluster
+func setHealthCondition(kafka *litekafkav1alpha1.KafkaCluster, health *litekafkav1alpha1.HealthStatus) {
+	switch {
+	case health.ControllerID < 0:
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionHealthy, corev1.ConditionFalse, "NoActiveController",
+			"Cluster has no active controller")
+	case int32(len(health.Brokers)) < kafka.Spec.Replicas:
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionHealthy, corev1.ConditionFalse, "BrokersUnavailable",
+			fmt.Sprintf("%d of %d brokers are registered in cluster", len(health.Brokers), kafka.Spec.Replicas))
+	case health.OfflinePartitions > 0:
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionHealthy, corev1.ConditionFalse, "OfflinePartitions",
+			fmt.Sprintf("%d partitions have no leader", health.OfflinePartitions))
+	case health.UnderReplicatedPartitions > 0:
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionHealthy, corev1.ConditionFalse, "UnderReplicatedPartitions",
+			fmt.Sprintf("%d partitions are under-replicated", health.UnderReplicatedPartitions))
+	default:
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionHealthy, corev1.ConditionTrue, "Healthy",
+			"All brokers are registered and all partitions are in sync")
+	}
+}
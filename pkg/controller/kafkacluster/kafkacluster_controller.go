@@ -2,12 +2,24 @@ package kafkacluster
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka/admin"
+	"github.com/Svimba/lite-kafka-operator/pkg/zookeeper"
+	monitoringv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/go-logr/logr"
+	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -19,11 +31,6 @@ import (
 
 var log = logf.Log.WithName("controller_kafkacluster")
 
-/**
-* USER ACTION REQUIRED: This is a scaffold file intended for the user to modify with their own Controller
-* business logic.  Delete these comments after modifying this file.*
- */
-
 // Add creates a new KafkaCluster Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -31,14 +38,33 @@ func Add(mgr manager.Manager) error {
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileKafkaCluster{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(mgr manager.Manager) *ReconcileKafkaCluster {
+	reconciler := &ReconcileKafkaCluster{
+		client:           mgr.GetClient(),
+		scheme:           mgr.GetScheme(),
+		recorder:         mgr.GetRecorder("kafkacluster-controller"),
+		adminFactory:     admin.NewFactory(kafkaRequestTimeout),
+		zookeeperFactory: zookeeper.NewClient,
+		zookeeperChecker: CheckZookeeperIsReady,
+		options:          options,
+	}
+	// Discovery detects optional resources of prometheus-operator
+	dc, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Error(err, "Cannot create discovery client, ServiceMonitors and PrometheusRules are not managed")
+	} else {
+		reconciler.discovery = dc
+	}
+	return reconciler
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
+func add(mgr manager.Manager, r *ReconcileKafkaCluster) error {
 	// Create a new controller
-	c, err := controller.New("kafkacluster-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("kafkacluster-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: options.MaxConcurrentReconciles,
+	})
 	if err != nil {
 		return err
 	}
@@ -49,11 +75,48 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	// TODO(user): Modify this to be the types you create that are owned by the primary resource
-	// Watch for changes to secondary resource Pods and requeue the owner KafkaCluster
-	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &litekafkav1alpha1.KafkaCluster{},
+	// Watch for changes to resources created by operator, so changed or deleted resources are repaired immediately
+	owned := []runtime.Object{
+		&appsv1.StatefulSet{},
+		&corev1.Service{},
+		&corev1.ConfigMap{},
+		&policyv1beta1.PodDisruptionBudget{},
+	}
+	if r.discovery != nil {
+		// Resources of prometheus-operator can be watched and managed only when they are installed,
+		// they are discovered once, operator has to be restarted after prometheus-operator is installed
+		r.monitoring = map[string]bool{}
+		for _, kind := range []struct {
+			kind string
+			obj  runtime.Object
+		}{
+			{monitoringv1.ServiceMonitorsKind, &monitoringv1.ServiceMonitor{}},
+			{monitoringv1.PrometheusRuleKind, &monitoringv1.PrometheusRule{}},
+		} {
+			exists, err := k8sutil.ResourceExists(r.discovery, monitoringv1.SchemeGroupVersion.String(), kind.kind)
+			if err != nil {
+				return err
+			}
+			if exists {
+				r.monitoring[kind.kind] = true
+				owned = append(owned, kind.obj)
+			}
+		}
+	}
+	for _, obj := range owned {
+		err = c.Watch(&source.Kind{Type: obj}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &litekafkav1alpha1.KafkaCluster{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Pods are owned by StatefulSets, they are mapped to KafkaCluster by labels,
+	// so rolling of pods and assignment of racks continue as soon as pod changes
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(getPodKafkaCluster),
 	})
 	if err != nil {
 		return err
@@ -62,6 +125,19 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	return nil
 }
 
+// getPodKafkaCluster returns request of KafkaCluster which pod of brokers, controllers or zookeeper belongs to
+func getPodKafkaCluster(pod handler.MapObject) []reconcile.Request {
+	labels := pod.Meta.GetLabels()
+	name := labels["app.kubernetes.io/name"]
+	instance := labels["app.kubernetes.io/instance"]
+	if (name != "kafka" && name != "zookeeper") || len(instance) == 0 {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: instance, Namespace: pod.Meta.GetNamespace()}},
+	}
+}
+
 // blank assignment to verify that ReconcileKafkaCluster implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileKafkaCluster{}
 
@@ -69,10 +145,20 @@ var _ reconcile.Reconciler = &ReconcileKafkaCluster{}
 type ReconcileKafkaCluster struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
-	kafka  *litekafkav1alpha1.KafkaCluster
-	rlog   logr.Logger
+	client    client.Client
+	scheme    *runtime.Scheme
+	recorder  record.EventRecorder
+	discovery discovery.DiscoveryInterface
+	// monitoring has installed kinds of prometheus-operator, they are discovered when controller is added
+	monitoring map[string]bool
+	// adminFactory connects to brokers of cluster, tests replace it by fake
+	adminFactory admin.Factory
+	// zookeeperFactory connects to zookeeper of cluster, tests replace it by fake
+	zookeeperFactory zookeeper.Factory
+	// zookeeperChecker checks zookeeper of cluster and members of managed zookeeper before they are restarted,
+	// tests replace it by fake
+	zookeeperChecker zookeeperChecker
+	options          Options
 }
 
 // Reconcile reads that state of the cluster for a KafkaCluster object and makes changes based on the state read
@@ -81,50 +167,229 @@ type ReconcileKafkaCluster struct {
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 func (r *ReconcileKafkaCluster) Reconcile(request reconcile.Request) (reconcile.Result, error) {
-	r.rlog = log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
-	r.rlog.Info("Reconciling KafkaCluster")
+	rlog := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	rlog.Info("Reconciling KafkaCluster")
 
 	// Fetch the KafkaCluster instance
-	r.kafka = &litekafkav1alpha1.KafkaCluster{}
-	err := r.client.Get(context.TODO(), request.NamespacedName, r.kafka)
+	kafka := &litekafkav1alpha1.KafkaCluster{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, kafka)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, cleanup of cluster is done by teardown finalizer.
 			// Return and don't requeue
+			deleteClusterMetrics(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
+	if err = r.addTeardownFinalizer(kafka); err != nil {
+		return reconcile.Result{Requeue: true}, err
+	}
+
 	// set default values for undefined specs
-	r.kafka.SetDefaults()
+	kafka.SetDefaults()
+	rm := newReconcileMetrics(kafka)
+	defer r.observeClusterState(kafka)
 
-	// Check zookeeper service is ready
-	if *r.kafka.Spec.ZookeeperCheck {
-		ready, err := CheckZookeeperIsReady(r.kafka.Spec.Zookeeper.Host, r.kafka.Spec.Zookeeper.Port.Port)
+	// Mode of running cluster is recorded on first deploy, later change of spec.mode starts migration
+	if len(kafka.Status.Mode) == 0 {
+		status := kafka.Status.DeepCopy()
+		kafka.Status.Mode = kafka.Spec.Mode
+		if err = r.updateStatus(kafka, status); err != nil {
+			return reconcile.Result{Requeue: true}, err
+		}
+	}
+
+	// Paused cluster is left to manual changes, only its status is updated, also its teardown waits
+	// until reconcile is resumed
+	if kafka.IsPaused() {
+		return r.reconcilePaused(kafka, rlog), nil
+	}
+	// Resumed condition is written at the end of reconcile, cluster can be gone after teardown
+	if status := kafka.Status.DeepCopy(); r.resumeReconcile(kafka, rlog) {
+		defer func() {
+			if err := r.updateStatus(kafka, status); err != nil && !errors.IsNotFound(err) {
+				rlog.Error(err, "Cannot update status of KafkaCluster")
+			}
+		}()
+	}
+	if kafka.DeletionTimestamp != nil {
+		return r.reconcileDeletion(kafka, rlog)
+	}
+	// Spec which cannot be applied to running cluster is not reconciled until it is fixed
+	if valid, err := r.checkSpec(kafka, rlog); err != nil || !valid {
+		return reconcile.Result{}, err
+	}
+
+	// Services and ConfigMaps do not need zookeeper, they are reconciled also while waiting for it
+	requeue, err := r.handleSVCsKafka(kafka, rlog)
+	rm.observe(phaseServices, err)
+	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot deploy services of brokers")
+		return reconcile.Result{Requeue: requeue}, err
+	}
+	err = r.handleBrokerIDsKafka(kafka, rlog)
+	rm.observe(phaseBrokerIDs, err)
+	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot assign IDs of brokers")
+		return reconcile.Result{}, err
+	}
+	err = r.handleMetricsKafka(kafka, rlog)
+	rm.observe(phaseMetrics, err)
+	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot deploy metrics of brokers")
+		return reconcile.Result{}, err
+	}
+	err = r.handleMonitoringKafka(kafka, rlog)
+	rm.observe(phaseMonitoring, err)
+	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot deploy monitoring of cluster")
+		return reconcile.Result{}, err
+	}
+
+	if kafka.Status.Mode == litekafkav1alpha1.ModeKRaft {
+		if kafka.Spec.Mode != litekafkav1alpha1.ModeKRaft {
+			rlog.Info("Cluster runs in KRaft mode, migration to Zookeeper is not supported")
+			r.recorder.Event(kafka, corev1.EventTypeWarning, "MigrationNotSupported", "Cluster runs in KRaft mode, migration to Zookeeper is not supported")
+		}
+		// KRaft controllers replace zookeeper
+		requeue, err := r.handleKRaft(kafka, rlog)
+		rm.observe(phaseKRaft, err)
+		if err != nil {
+			r.reconcileFailed(kafka, rlog, err, "Cannot deploy KRaft controllers")
+			return reconcile.Result{Requeue: requeue}, err
+		}
+	} else {
+		result, ready, err := r.reconcileZookeeper(kafka, rlog)
+		rm.observe(phaseZookeeper, err)
+		if err != nil || !ready {
+			return result, err
+		}
+		// Brokers are rolled by migration phases until cluster runs in KRaft mode
+		result, migrating, err := r.reconcileMigration(kafka, rlog)
+		rm.observe(phaseMigration, err)
 		if err != nil {
-			r.rlog.Error(err, "Error during testing Zookeeper service")
-			return reconcile.Result{Requeue: false}, err
+			return result, err
 		}
-		if !ready {
-			r.rlog.Info("Zookeeper service is not ready, reconcile")
-			return reconcile.Result{Requeue: true}, nil
+		if migrating {
+			return result, nil
 		}
-		r.rlog.Info("Zookeeper service is ready, continue to deploy resources")
 	}
 
 	// Start resourec handling
-	requeue, err := r.handleSTSKafka()
+	requeue, err = r.handleSTSKafka(kafka, rlog)
+	rm.observe(phaseBrokers, err)
 	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot deploy brokers")
 		return reconcile.Result{Requeue: requeue}, err
 	}
 
-	requeue, err = r.handleSVCsKafka()
+	requeue, err = r.handlePodsRack(kafka, rlog)
+	rm.observe(phaseRack, err)
 	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot set rack of brokers")
 		return reconcile.Result{Requeue: requeue}, err
 	}
+	if requeue {
+		rlog.Info("Waiting for broker pods to get rack")
+		r.recorder.Event(kafka, corev1.EventTypeNormal, "WaitingForRack", "Waiting for broker pods to be scheduled and get rack")
+		return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	result := r.reconcileHealth(kafka, rlog)
+	rm.observe(phaseHealth, nil)
+	return result, nil
+}
+
+// reconcileZookeeper deploys managed zookeeper, checks zookeeper is ready and prepares chroot,
+// it returns true when brokers can be deployed
+func (r *ReconcileKafkaCluster) reconcileZookeeper(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (reconcile.Result, bool, error) {
+	// Deploy managed zookeeper before it is checked
+	requeue, err := r.handleZookeeper(kafka, rlog)
+	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot deploy managed Zookeeper")
+		return reconcile.Result{Requeue: requeue}, false, err
+	}
+
+	zkOptions, err := r.getZookeeperConnectionOptions(kafka)
+	if err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot get Zookeeper connection options")
+		return reconcile.Result{}, false, err
+	}
 
-	return reconcile.Result{}, nil
+	// Check zookeeper service is ready
+	if *kafka.Spec.ZookeeperCheck {
+		status := kafka.Status.DeepCopy()
+		r.checkZookeeper(kafka, zkOptions)
+		if statusErr := r.updateStatus(kafka, status); statusErr != nil {
+			rlog.Error(statusErr, "Cannot update status of KafkaCluster")
+		}
+		if !kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionZookeeperReady) {
+			return r.waitForZookeeper(kafka, rlog), false, nil
+		}
+		if !status.IsConditionTrue(litekafkav1alpha1.ConditionZookeeperReady) {
+			r.recorder.Event(kafka, corev1.EventTypeNormal, "ZookeeperReady", "Zookeeper quorum is available")
+		}
+		rlog.Info("Zookeeper service is ready, continue to deploy resources")
+	}
+
+	// Create chroot znode of cluster
+	_, err = r.handleZookeeperChroot(kafka, rlog, zkOptions)
+	if err != nil {
+		status := kafka.Status.DeepCopy()
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionZookeeperReady, corev1.ConditionFalse, "ChrootUnavailable",
+			fmt.Sprintf("Cannot create chroot %s: %v", kafka.Spec.Zookeeper.Chroot, err))
+		if statusErr := r.updateStatus(kafka, status); statusErr != nil {
+			rlog.Error(statusErr, "Cannot update status of KafkaCluster")
+		}
+		return r.waitForZookeeper(kafka, rlog), false, nil
+	}
+
+	return reconcile.Result{}, true, nil
+}
+
+// waitForZookeeper returns result of reconcile waiting for zookeeper, delay is as long as zookeeper
+// is not ready already, so it doubles with every retry between backoff base and max
+func (r *ReconcileKafkaCluster) waitForZookeeper(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) reconcile.Result {
+	delay := r.options.ZookeeperBackoffBase
+	message := ""
+	condition := kafka.Status.GetCondition(litekafkav1alpha1.ConditionZookeeperReady)
+	if condition != nil && condition.Status != corev1.ConditionTrue {
+		if elapsed := time.Since(condition.LastTransitionTime.Time); elapsed > delay {
+			delay = elapsed
+		}
+		message = condition.Message
+	}
+	if delay > r.options.ZookeeperBackoffMax {
+		delay = r.options.ZookeeperBackoffMax
+	}
+	delay = delay.Round(time.Second)
+
+	rlog.Info("Zookeeper service is not ready, reconcile later", "RequeueAfter", delay.String(), "Reason", message)
+	r.recorder.Eventf(kafka, corev1.EventTypeWarning, "ZookeeperNotReady", "Waiting for Zookeeper, retry in %s: %s", delay, message)
+	return reconcile.Result{RequeueAfter: delay}
+}
+
+// reconcileFailed logs error of reconcile step and records it as warning event
+func (r *ReconcileKafkaCluster) reconcileFailed(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, err error, message string) {
+	rlog.Error(err, message)
+	r.recorder.Eventf(kafka, corev1.EventTypeWarning, "ReconcileFailed", "%s: %v", message, err)
+}
+
+// updateStatus writes status of KafkaCluster if it differs from original, client decodes response
+// of apiserver into updated object, so copy is written and defaulted spec of kafka is kept
+func (r *ReconcileKafkaCluster) updateStatus(kafka *litekafkav1alpha1.KafkaCluster, original *litekafkav1alpha1.KafkaClusterStatus) error {
+	if equality.Semantic.DeepEqual(original, &kafka.Status) {
+		return nil
+	}
+	update := kafka.DeepCopy()
+	if err := r.client.Status().Update(context.TODO(), update); err != nil {
+		return err
+	}
+	kafka.ResourceVersion = update.ResourceVersion
+	kafka.Status = update.Status
+	return nil
 }
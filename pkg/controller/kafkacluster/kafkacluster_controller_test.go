@@ -0,0 +1,1513 @@
+package kafkacluster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Svimba/lite-kafka-operator/pkg/apis"
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka"
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka/admin/fake"
+	"github.com/Svimba/lite-kafka-operator/pkg/zookeeper"
+	zkfake "github.com/Svimba/lite-kafka-operator/pkg/zookeeper/fake"
+	monitoringv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+const (
+	testName      = "test"
+	testNamespace = "kafka"
+)
+
+func TestMain(m *testing.M) {
+	// Delegating logger is not safe for concurrent use until real logger is set
+	logf.SetLogger(logf.ZapLoggerTo(ioutil.Discard, true))
+	os.Exit(m.Run())
+}
+
+// testReconciler is a reconciler with fake client, recorder and Kafka cluster
+type testReconciler struct {
+	*ReconcileKafkaCluster
+	recorder  *record.FakeRecorder
+	admin     *fake.Client
+	zookeeper *zkfake.Conn
+}
+
+func newTestReconciler(t *testing.T, objs ...runtime.Object) *testReconciler {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := apis.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := monitoringv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(100)
+	adminClient := fake.NewClient(0, 1, 2)
+	zkConn := zkfake.NewConn(nil)
+	return &testReconciler{
+		ReconcileKafkaCluster: &ReconcileKafkaCluster{
+			client:           &statusSubresourceClient{Client: fakeclient.NewFakeClientWithScheme(s, objs...)},
+			scheme:           s,
+			recorder:         recorder,
+			adminFactory:     adminClient.Factory(),
+			zookeeperFactory: zkConn.Factory(),
+			zookeeperChecker: CheckZookeeperIsReady,
+			options: Options{
+				ZookeeperBackoffBase: 5 * time.Second,
+				ZookeeperBackoffMax:  time.Minute,
+				HealthCheckInterval:  30 * time.Second,
+			},
+		},
+		recorder:  recorder,
+		admin:     adminClient,
+		zookeeper: zkConn,
+	}
+}
+
+// statusSubresourceClient writes status of KafkaCluster like apiserver, only status is stored and
+// stored object is decoded back into updated one, fake client stores whole object instead
+type statusSubresourceClient struct {
+	client.Client
+	// updates counts written statuses of KafkaCluster
+	updates int32
+}
+
+func (c *statusSubresourceClient) Status() client.StatusWriter {
+	return statusSubresourceWriter{c}
+}
+
+type statusSubresourceWriter struct {
+	client *statusSubresourceClient
+}
+
+func (w statusSubresourceWriter) Update(ctx context.Context, obj runtime.Object) error {
+	kafka, ok := obj.(*litekafkav1alpha1.KafkaCluster)
+	if !ok {
+		return w.client.Client.Status().Update(ctx, obj)
+	}
+	atomic.AddInt32(&w.client.updates, 1)
+	stored := &litekafkav1alpha1.KafkaCluster{}
+	if err := w.client.Get(ctx, types.NamespacedName{Name: kafka.Name, Namespace: kafka.Namespace}, stored); err != nil {
+		return err
+	}
+	kafka.Status.DeepCopyInto(&stored.Status)
+	if err := w.client.Update(ctx, stored); err != nil {
+		return err
+	}
+	*kafka = *stored
+	return nil
+}
+
+func (r *testReconciler) reconcile(t *testing.T) reconcile.Result {
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}})
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	return result
+}
+
+// events returns events recorded since last call
+func (r *testReconciler) events() []string {
+	events := []string{}
+	for {
+		select {
+		case event := <-r.recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// statusUpdates returns number of status writes since last call
+func (r *testReconciler) statusUpdates() int32 {
+	return atomic.SwapInt32(&r.client.(*statusSubresourceClient).updates, 0)
+}
+
+func (r *testReconciler) get(t *testing.T, name string, obj runtime.Object) {
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, obj); err != nil {
+		t.Fatalf("cannot get %s: %v", name, err)
+	}
+}
+
+// rollOut does work of StatefulSet controller, all pods of StatefulSet are ready in its update revision,
+// current revision is not advanced as with OnDelete strategy
+func (r *testReconciler) rollOut(t *testing.T, name string) {
+	sts := &appsv1.StatefulSet{}
+	r.get(t, name, sts)
+	sts.Status.UpdateRevision = name + "-current"
+	sts.Status.CurrentRevision = name + "-initial"
+	sts.Status.Replicas = *sts.Spec.Replicas
+	sts.Status.ReadyReplicas = *sts.Spec.Replicas
+	sts.Status.UpdatedReplicas = *sts.Spec.Replicas
+	if err := r.client.Status().Update(context.TODO(), sts); err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(0); i < *sts.Spec.Replicas; i++ {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", name, i),
+			Namespace: testNamespace,
+			Labels:    map[string]string{appsv1.StatefulSetRevisionLabel: sts.Status.UpdateRevision},
+		}}
+		for key, value := range sts.Spec.Selector.MatchLabels {
+			pod.Labels[key] = value
+		}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		r.client.Delete(context.TODO(), pod)
+		if err := r.client.Create(context.TODO(), pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// syncStatefulSet does work of StatefulSet controller with OnDelete strategy, missing pods are created ready
+// in revision of current template, pods above replicas are deleted and other pods keep their revision
+func (r *testReconciler) syncStatefulSet(t *testing.T, name string) {
+	sts := &appsv1.StatefulSet{}
+	r.get(t, name, sts)
+	sts.Status.UpdateRevision = name + "-" + sts.Annotations[templateHashAnnotation][:10]
+	pods := &corev1.PodList{}
+	if err := r.client.List(context.TODO(), client.InNamespace(testNamespace).MatchingLabels(sts.Spec.Selector.MatchLabels), pods); err != nil {
+		t.Fatal(err)
+	}
+	existing := map[string]bool{}
+	for i := range pods.Items {
+		if int32(getPodOrdinal(&pods.Items[i])) >= *sts.Spec.Replicas {
+			r.client.Delete(context.TODO(), &pods.Items[i])
+		}
+		existing[pods.Items[i].Name] = true
+	}
+	for i := int32(0); i < *sts.Spec.Replicas; i++ {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", name, i),
+			Namespace: testNamespace,
+			Labels:    map[string]string{appsv1.StatefulSetRevisionLabel: sts.Status.UpdateRevision},
+		}}
+		if existing[pod.Name] {
+			continue
+		}
+		for key, value := range sts.Spec.Selector.MatchLabels {
+			pod.Labels[key] = value
+		}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		if err := r.client.Create(context.TODO(), pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sts.Status.Replicas = *sts.Spec.Replicas
+	sts.Status.ReadyReplicas = *sts.Spec.Replicas
+	sts.Status.UpdatedReplicas = 0
+	for _, revision := range r.podRevisions(t, sts) {
+		if revision == sts.Status.UpdateRevision {
+			sts.Status.UpdatedReplicas++
+		}
+	}
+	if err := r.client.Status().Update(context.TODO(), sts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// podRevisions returns revisions of pods of StatefulSet by pod name
+func (r *testReconciler) podRevisions(t *testing.T, sts *appsv1.StatefulSet) map[string]string {
+	pods := &corev1.PodList{}
+	if err := r.client.List(context.TODO(), client.InNamespace(testNamespace).MatchingLabels(sts.Spec.Selector.MatchLabels), pods); err != nil {
+		t.Fatal(err)
+	}
+	revisions := map[string]string{}
+	for _, pod := range pods.Items {
+		revisions[pod.Name] = pod.Labels[appsv1.StatefulSetRevisionLabel]
+	}
+	return revisions
+}
+
+func (r *testReconciler) getKafkaCluster(t *testing.T) *litekafkav1alpha1.KafkaCluster {
+	kafka := &litekafkav1alpha1.KafkaCluster{}
+	r.get(t, testName, kafka)
+	return kafka
+}
+
+// newTestKafkaCluster returns cluster using zookeeper server on address
+func newTestKafkaCluster(address string) *litekafkav1alpha1.KafkaCluster {
+	return &litekafkav1alpha1.KafkaCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+		Spec: litekafkav1alpha1.KafkaClusterSpec{
+			Zookeeper: &litekafkav1alpha1.ZookeeperSpec{
+				Servers: []string{address},
+			},
+		},
+	}
+}
+
+// startFakeZookeeper runs standalone zookeeper answering four letter words until tests exit, it returns its address
+func startFakeZookeeper(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				command := make([]byte, 4)
+				if _, err := io.ReadFull(conn, command); err != nil {
+					return
+				}
+				switch string(command) {
+				case "ruok":
+					io.WriteString(conn, "imok")
+				case "srvr":
+					io.WriteString(conn, "Zookeeper version: 3.5.5\nMode: standalone\nNode count: 5\n")
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// unusedAddress returns address nobody listens on
+func unusedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestReconcileNotFound(t *testing.T) {
+	r := newTestReconciler(t)
+	if result := r.reconcile(t); result != (reconcile.Result{}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestReconcileCreatesResources(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+
+	result := r.reconcile(t)
+	if result.RequeueAfter != r.options.HealthCheckInterval {
+		t.Errorf("expected health check in %s, got %+v", r.options.HealthCheckInterval, result)
+	}
+
+	sts := &appsv1.StatefulSet{}
+	r.get(t, "test-kafka", sts)
+	if *sts.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %d", *sts.Spec.Replicas)
+	}
+	if len(sts.OwnerReferences) != 1 || sts.OwnerReferences[0].Name != testName {
+		t.Errorf("StatefulSet is not owned by KafkaCluster: %+v", sts.OwnerReferences)
+	}
+	r.get(t, "test-kafka", &corev1.Service{})
+	r.get(t, "test-kafka-headless", &corev1.Service{})
+	r.get(t, "test-kafka", &policyv1beta1.PodDisruptionBudget{})
+
+	kafka := r.getKafkaCluster(t)
+	if kafka.Status.Mode != litekafkav1alpha1.ModeZookeeper {
+		t.Errorf("expected zookeeper mode in status, got %q", kafka.Status.Mode)
+	}
+	if !kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionZookeeperReady) {
+		t.Errorf("zookeeper is not ready: %+v", kafka.Status.GetCondition(litekafkav1alpha1.ConditionZookeeperReady))
+	}
+	if !kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionHealthy) {
+		t.Errorf("cluster is not healthy: %+v", kafka.Status.GetCondition(litekafkav1alpha1.ConditionHealthy))
+	}
+	if kafka.Status.Health == nil || len(kafka.Status.Health.Brokers) != 3 {
+		t.Errorf("expected 3 brokers in status, got %+v", kafka.Status.Health)
+	}
+}
+
+func TestReconcileKeepsDefaultsAfterStatusUpdate(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+
+	// Status is written several times during first reconcile, defaults must survive every write
+	r.reconcile(t)
+
+	kafka := r.getKafkaCluster(t)
+	if kafka.Spec.ServicePort != nil || kafka.Spec.Zookeeper.Port != nil || kafka.Spec.Deletion != nil {
+		t.Errorf("defaults are written into spec: %+v", kafka.Spec)
+	}
+	if len(kafka.Status.Conditions) == 0 {
+		t.Error("status is not written")
+	}
+	svc := &corev1.Service{}
+	r.get(t, "test-kafka", svc)
+	if len(svc.Spec.Ports) == 0 || svc.Spec.Ports[0].Port != 9092 {
+		t.Errorf("expected default port 9092, got %+v", svc.Spec.Ports)
+	}
+}
+
+func TestReconcileKRaft(t *testing.T) {
+	kafka := newTestKafkaCluster("")
+	kafka.Spec.Zookeeper = nil
+	kafka.Spec.Mode = litekafkav1alpha1.ModeKRaft
+	kafka.Spec.KRaft = &litekafkav1alpha1.KRaftSpec{ControllerReplicas: 3}
+	r := newTestReconciler(t, kafka)
+
+	// Mode and cluster ID are written to status before controllers and brokers are deployed
+	r.reconcile(t)
+
+	kafka = r.getKafkaCluster(t)
+	if kafka.Status.Mode != litekafkav1alpha1.ModeKRaft || len(kafka.Status.ClusterID) == 0 {
+		t.Fatalf("expected KRaft mode and cluster ID in status, got %+v", kafka.Status)
+	}
+	if kafka.Spec.KRaft.ControllerPort != nil {
+		t.Errorf("defaults are written into spec: %+v", kafka.Spec.KRaft)
+	}
+	controllers := &appsv1.StatefulSet{}
+	r.get(t, "test-controller", controllers)
+	clusterID := ""
+	for _, env := range controllers.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == "CLUSTER_ID" {
+			clusterID = env.Value
+		}
+	}
+	if clusterID != kafka.Status.ClusterID {
+		t.Errorf("expected controllers with cluster ID %s, got %q", kafka.Status.ClusterID, clusterID)
+	}
+	r.get(t, "test-kafka", &appsv1.StatefulSet{})
+
+	// Cluster ID is generated only once
+	r.reconcile(t)
+	if id := r.getKafkaCluster(t).Status.ClusterID; id != kafka.Status.ClusterID {
+		t.Errorf("cluster ID changed from %s to %s", kafka.Status.ClusterID, id)
+	}
+}
+
+func TestReconcileKeepsKRaftVoters(t *testing.T) {
+	kafka := newTestKafkaCluster("")
+	kafka.Spec.Zookeeper = nil
+	kafka.Spec.Mode = litekafkav1alpha1.ModeKRaft
+	kafka.Spec.Replicas = 1
+	r := newTestReconciler(t, kafka)
+	r.reconcile(t)
+
+	sts := &appsv1.StatefulSet{}
+	r.get(t, "test-kafka", sts)
+	voters := containerEnv(sts.Spec.Template.Spec.Containers[0], "KAFKA_CONTROLLER_QUORUM_VOTERS")
+	if voters != "0@test-kafka-0.test-kafka-headless.kafka.svc:9093" {
+		t.Fatalf("expected single voter, got %q", voters)
+	}
+	r.events()
+
+	// Voters of static quorum are kept when brokers are scaled
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.Replicas = 3
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	r.get(t, "test-kafka", sts)
+	if *sts.Spec.Replicas != 3 {
+		t.Errorf("expected 3 brokers, got %d", *sts.Spec.Replicas)
+	}
+	if actual := containerEnv(sts.Spec.Template.Spec.Containers[0], "KAFKA_CONTROLLER_QUORUM_VOTERS"); actual != voters {
+		t.Errorf("expected voters %q after scaling, got %q", voters, actual)
+	}
+	if quorum := r.getKafkaCluster(t).Status.KRaft; quorum == nil || quorum.Voters != 1 {
+		t.Errorf("expected 1 voter in status, got %+v", quorum)
+	}
+	r.events()
+
+	// Dedicated controllers would replace voters, spec is rejected
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.KRaft = &litekafkav1alpha1.KRaftSpec{ControllerReplicas: 3}
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	expected := []string{"Warning KRaftQuorumChanged spec.kraft.controllerReplicas cannot be changed from 0, voters of KRaft quorum are static"}
+	if events := r.events(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+	if r.getKafkaCluster(t).Status.IsConditionTrue(litekafkav1alpha1.ConditionSpecValid) {
+		t.Error("expected spec to be invalid")
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-controller", Namespace: testNamespace}, &appsv1.StatefulSet{}); err == nil {
+		t.Error("expected no dedicated controllers")
+	}
+
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.KRaft = nil
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	if !r.getKafkaCluster(t).Status.IsConditionTrue(litekafkav1alpha1.ConditionSpecValid) {
+		t.Error("expected spec to be valid again")
+	}
+}
+
+// containerEnv returns value of environment variable of container
+func containerEnv(container corev1.Container, name string) string {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+func TestReconcileRejectsInvalidBrokerIDOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		offset   int32
+		expected string
+	}{
+		{name: "zookeeper", mode: litekafkav1alpha1.ModeZookeeper, offset: 998},
+		{
+			name:     "zookeeper reserved IDs",
+			mode:     litekafkav1alpha1.ModeZookeeper,
+			offset:   999,
+			expected: "Warning InvalidBrokerIDOffset spec.brokerIdOffset 999 gives broker IDs up to 1001, IDs above 1000 are reserved by zookeeper",
+		},
+		{
+			name:     "negative",
+			mode:     litekafkav1alpha1.ModeZookeeper,
+			offset:   -1,
+			expected: "Warning InvalidBrokerIDOffset spec.brokerIdOffset -1 is negative",
+		},
+		{name: "kraft", mode: litekafkav1alpha1.ModeKRaft, offset: 8997},
+		{
+			name:     "kraft controller IDs",
+			mode:     litekafkav1alpha1.ModeKRaft,
+			offset:   8998,
+			expected: "Warning InvalidBrokerIDOffset spec.brokerIdOffset 8998 gives broker IDs up to 9000, IDs from 9000 are used by KRaft controllers",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kafka := newTestKafkaCluster(startFakeZookeeper(t))
+			kafka.Spec.Mode = test.mode
+			kafka.Spec.BrokerIDOffset = test.offset
+			if test.mode == litekafkav1alpha1.ModeKRaft {
+				kafka.Spec.Zookeeper = nil
+				kafka.Spec.KRaft = &litekafkav1alpha1.KRaftSpec{ControllerReplicas: 3}
+			}
+			r := newTestReconciler(t, kafka)
+			r.reconcile(t)
+
+			var expected []string
+			if len(test.expected) > 0 {
+				expected = []string{test.expected}
+			}
+			var warnings []string
+			for _, event := range r.events() {
+				if strings.HasPrefix(event, corev1.EventTypeWarning) {
+					warnings = append(warnings, event)
+				}
+			}
+			if !reflect.DeepEqual(warnings, expected) {
+				t.Errorf("expected warnings %q, got %q", expected, warnings)
+			}
+			err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-kafka", Namespace: testNamespace}, &appsv1.StatefulSet{})
+			if deployed := err == nil; deployed != (len(test.expected) == 0) {
+				t.Errorf("expected brokers deployed %v, got %v", len(test.expected) == 0, deployed)
+			}
+			condition := r.getKafkaCluster(t).Status.GetCondition(litekafkav1alpha1.ConditionSpecValid)
+			if rejected := condition != nil && condition.Status == corev1.ConditionFalse; rejected != (len(test.expected) > 0) {
+				t.Errorf("expected spec rejected %v, got condition %+v", len(test.expected) > 0, condition)
+			}
+		})
+	}
+}
+
+func TestReconcileMigrationRollback(t *testing.T) {
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	kafka.Spec.KRaft = &litekafkav1alpha1.KRaftSpec{ControllerReplicas: 3}
+	kafka.Status.Mode = litekafkav1alpha1.ModeZookeeper
+	kafka.Status.SetMigrationPhase(litekafkav1alpha1.MigrationPhaseBrokersMigration)
+	r := newTestReconciler(t, kafka)
+	// Controllers copied metadata before migration was rolled back
+	r.zookeeper = zkfake.NewConn(map[string]string{
+		"/cluster/id": `{"version":"1","id":"MkU3OEVBNTcwNTJENDM2Qg"}`,
+		"/controller": `{"version":2,"brokerid":9000,"kraftControllerEpoch":1}`,
+		"/migration":  `{"version":0,"kraft_metadata_offset":42,"kraft_controller_id":9000,"kraft_metadata_epoch":1}`,
+	})
+	r.zookeeperFactory = r.zookeeper.Factory()
+
+	r.reconcile(t)
+	r.rollOut(t, "test-kafka")
+	r.reconcile(t)
+
+	if migration := r.getKafkaCluster(t).Status.Migration; migration != nil {
+		t.Fatalf("migration is not rolled back: %+v", migration)
+	}
+	for _, znode := range []string{"/controller", "/migration"} {
+		if r.zookeeper.Has(znode) {
+			t.Errorf("znode %s of KRaft controllers is not deleted", znode)
+		}
+	}
+
+	// Retried migration waits until new controllers copy metadata
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.Mode = litekafkav1alpha1.ModeKRaft
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	r.reconcile(t)
+	r.rollOut(t, "test-controller")
+	r.reconcile(t)
+	r.events()
+	r.reconcile(t)
+
+	if phase := r.getKafkaCluster(t).Status.GetMigrationPhase(); phase != litekafkav1alpha1.MigrationPhaseBrokersMigration {
+		t.Fatalf("expected migration in phase %s, got %s", litekafkav1alpha1.MigrationPhaseBrokersMigration, phase)
+	}
+	expected := "Normal WaitingForMetadataMigration Waiting for KRaft controllers to migrate metadata from Zookeeper"
+	if events := r.events(); len(events) == 0 || events[len(events)-1] != expected {
+		t.Errorf("expected event %q, got %q", expected, events)
+	}
+
+	r.zookeeper.Create("/migration", []byte(`{"version":0,"kraft_metadata_offset":7,"kraft_controller_id":9000,"kraft_metadata_epoch":1}`), 0, nil)
+	r.reconcile(t)
+	if phase := r.getKafkaCluster(t).Status.GetMigrationPhase(); phase != litekafkav1alpha1.MigrationPhaseBrokersKRaft {
+		t.Errorf("expected migration in phase %s, got %s", litekafkav1alpha1.MigrationPhaseBrokersKRaft, phase)
+	}
+}
+
+func TestReconcileScalesManagedZookeeper(t *testing.T) {
+	zookeeperCheck := false
+	kafka := newTestKafkaCluster("")
+	kafka.Spec.ZookeeperCheck = &zookeeperCheck
+	kafka.Spec.Zookeeper = &litekafkav1alpha1.ZookeeperSpec{Managed: true, Replicas: 3}
+	r := newTestReconciler(t, kafka)
+	quorum := true
+	r.zookeeperChecker = func(ctx context.Context, servers []string, tlsConfig *tls.Config) (*zookeeper.EnsembleStatus, error) {
+		ensemble := &zookeeper.EnsembleStatus{}
+		for _, server := range servers {
+			ensemble.Servers = append(ensemble.Servers, zookeeper.ServerStatus{Address: server, Ok: quorum, Serving: quorum})
+		}
+		return ensemble, nil
+	}
+	r.reconcile(t)
+	r.syncStatefulSet(t, "test-zookeeper")
+
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.Zookeeper.Replicas = 5
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensemble grows by one member, existing members are restarted one by one to get new server list
+	sts := &appsv1.StatefulSet{}
+	for step, replicas := range []int32{4, 5} {
+		r.reconcile(t)
+		r.get(t, "test-zookeeper", sts)
+		if *sts.Spec.Replicas != replicas {
+			t.Fatalf("step %d: expected %d members, got %d", step, replicas, *sts.Spec.Replicas)
+		}
+		servers := ""
+		for _, env := range sts.Spec.Template.Spec.Containers[0].Env {
+			if env.Name == "ZOO_SERVERS" {
+				servers = env.Value
+			}
+		}
+		if count := int32(strings.Count(servers, "server.")); count != replicas {
+			t.Errorf("step %d: expected %d servers, got %q", step, replicas, servers)
+		}
+
+		for restarted := int32(0); restarted < replicas-1; restarted++ {
+			r.syncStatefulSet(t, "test-zookeeper")
+			revisions := r.podRevisions(t, sts)
+			r.reconcile(t)
+			if deleted := len(revisions) - len(r.podRevisions(t, sts)); deleted != 1 {
+				t.Fatalf("step %d: expected one member restarted, %d are restarted", step, deleted)
+			}
+			r.get(t, "test-zookeeper", sts)
+			if *sts.Spec.Replicas != replicas {
+				t.Fatalf("step %d: ensemble is scaled to %d before all members are restarted", step, *sts.Spec.Replicas)
+			}
+		}
+		r.syncStatefulSet(t, "test-zookeeper")
+	}
+
+	// Member is not restarted without quorum
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.Zookeeper.Image = "zookeeper:3.5.6"
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	r.syncStatefulSet(t, "test-zookeeper")
+	quorum = false
+	r.events()
+	r.reconcile(t)
+	if pods := len(r.podRevisions(t, sts)); pods != 5 {
+		t.Errorf("member is restarted without quorum, %d members left", pods)
+	}
+	expected := "Normal WaitingForQuorum Waiting for quorum of managed Zookeeper before restart of member: 0/5 servers serving"
+	if events := r.events(); len(events) == 0 || events[0] != expected {
+		t.Errorf("expected event %q, got %q", expected, events)
+	}
+}
+
+func TestReconcileCreatesZookeeperChroot(t *testing.T) {
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	kafka.Spec.Zookeeper.Chroot = "/kafka/test"
+	r := newTestReconciler(t, kafka)
+
+	// Brokers are not deployed until chroot is created
+	r.zookeeper.Err = errors.New("connection refused")
+	r.reconcile(t)
+	condition := r.getKafkaCluster(t).Status.GetCondition(litekafkav1alpha1.ConditionZookeeperReady)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "ChrootUnavailable" {
+		t.Errorf("expected ChrootUnavailable condition, got %+v", condition)
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-kafka", Namespace: testNamespace}, &appsv1.StatefulSet{}); err == nil {
+		t.Error("brokers are deployed without chroot")
+	}
+	r.events()
+
+	r.zookeeper.Err = nil
+	r.reconcile(t)
+	if !r.zookeeper.Has("/kafka/test") {
+		t.Error("chroot is not created")
+	}
+	if chroot := r.getKafkaCluster(t).Status.ZookeeperChroot; chroot != "/kafka/test" {
+		t.Errorf("expected chroot /kafka/test in status, got %q", chroot)
+	}
+	r.get(t, "test-kafka", &appsv1.StatefulSet{})
+	expected := "Normal ChrootCreated Zookeeper chroot /kafka/test is ready"
+	if events := r.events(); !strings.Contains(strings.Join(events, "\n"), expected) {
+		t.Errorf("expected event %q, got %q", expected, events)
+	}
+
+	// Created chroot is recorded in status, zookeeper is not connected again
+	r.zookeeper.Err = errors.New("connection refused")
+	r.reconcile(t)
+	for _, event := range r.events() {
+		if strings.Contains(event, "Chroot") {
+			t.Errorf("chroot is created again: %q", event)
+		}
+	}
+}
+
+// newTestCertificate returns PEM encoded self-signed certificate and its key
+func newTestCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestGetZookeeperConnectionOptions(t *testing.T) {
+	cert, key := newTestCertificate(t)
+	tests := []struct {
+		name         string
+		tls          map[string][]byte
+		sasl         map[string][]byte
+		certificates int
+		username     string
+		err          string
+	}{
+		{name: "plain"},
+		{name: "server verified", tls: map[string][]byte{"ca.crt": cert}},
+		{name: "client certificate", tls: map[string][]byte{"ca.crt": cert, "tls.crt": cert, "tls.key": key}, certificates: 1},
+		{
+			name: "only stores of brokers",
+			tls:  map[string][]byte{"keystore.p12": []byte("p12"), "truststore.p12": []byte("p12"), "password": []byte("secret")},
+			err:  "secret zk-tls does not contain valid ca.crt",
+		},
+		{name: "invalid ca", tls: map[string][]byte{"ca.crt": []byte("not a certificate")}, err: "secret zk-tls does not contain valid ca.crt"},
+		{
+			name: "missing key",
+			tls:  map[string][]byte{"ca.crt": cert, "tls.crt": cert},
+			err:  "secret zk-tls does not contain valid tls.crt and tls.key",
+		},
+		{name: "sasl", sasl: map[string][]byte{"username": []byte("kafka"), "password": []byte("secret")}, username: "kafka"},
+		{name: "sasl without password", sasl: map[string][]byte{"username": []byte("kafka")}, err: "secret zk-sasl does not contain username and password"},
+		{
+			name:         "tls and sasl",
+			tls:          map[string][]byte{"ca.crt": cert, "tls.crt": cert, "tls.key": key},
+			sasl:         map[string][]byte{"username": []byte("kafka"), "password": []byte("secret")},
+			certificates: 1,
+			username:     "kafka",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kafka := newTestKafkaCluster("zookeeper:2181")
+			var objs []runtime.Object
+			if test.tls != nil {
+				kafka.Spec.Zookeeper.TLS = &litekafkav1alpha1.ZookeeperTLSSpec{SecretName: "zk-tls"}
+				objs = append(objs, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "zk-tls", Namespace: testNamespace}, Data: test.tls})
+			}
+			if test.sasl != nil {
+				kafka.Spec.Zookeeper.SASL = &litekafkav1alpha1.ZookeeperSASLSpec{SecretName: "zk-sasl"}
+				objs = append(objs, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "zk-sasl", Namespace: testNamespace}, Data: test.sasl})
+			}
+			r := newTestReconciler(t, objs...)
+
+			options, err := r.getZookeeperConnectionOptions(kafka)
+			if len(test.err) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (options.TLSConfig != nil) != (test.tls != nil) {
+				t.Errorf("expected TLS %v, got %+v", test.tls != nil, options.TLSConfig)
+			}
+			if options.TLSConfig != nil && len(options.TLSConfig.Certificates) != test.certificates {
+				t.Errorf("expected %d client certificates, got %d", test.certificates, len(options.TLSConfig.Certificates))
+			}
+			if options.Username != test.username {
+				t.Errorf("expected username %q, got %q", test.username, options.Username)
+			}
+		})
+	}
+
+	// Missing secret is reported
+	kafka := newTestKafkaCluster("zookeeper:2181")
+	kafka.Spec.Zookeeper.SASL = &litekafkav1alpha1.ZookeeperSASLSpec{SecretName: "zk-sasl"}
+	if _, err := newTestReconciler(t).getZookeeperConnectionOptions(kafka); err == nil {
+		t.Error("expected error of missing secret")
+	}
+}
+
+func TestReconcileChecksZookeeperByChecker(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster("zookeeper-0:2181"))
+	var checked []string
+	r.zookeeperChecker = func(ctx context.Context, servers []string, tlsConfig *tls.Config) (*zookeeper.EnsembleStatus, error) {
+		checked = append(checked, servers...)
+		return &zookeeper.EnsembleStatus{Servers: []zookeeper.ServerStatus{{Address: servers[0], Ok: true}}}, nil
+	}
+	r.reconcile(t)
+
+	if !reflect.DeepEqual(checked, []string{"zookeeper-0:2181"}) {
+		t.Errorf("expected zookeeper-0:2181 checked by checker, got %v", checked)
+	}
+	condition := r.getKafkaCluster(t).Status.GetCondition(litekafkav1alpha1.ConditionZookeeperReady)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "NoQuorum" {
+		t.Errorf("expected NoQuorum condition from checker, got %+v", condition)
+	}
+}
+
+func TestReconcileRejectsManagedZookeeperWithTLS(t *testing.T) {
+	kafka := newTestKafkaCluster("")
+	kafka.Spec.Zookeeper = &litekafkav1alpha1.ZookeeperSpec{
+		Managed: true,
+		TLS:     &litekafkav1alpha1.ZookeeperTLSSpec{SecretName: "zookeeper-tls"},
+	}
+	r := newTestReconciler(t, kafka)
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}})
+	if err == nil {
+		t.Fatal("expected error of unsupported TLS of managed Zookeeper")
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-zookeeper", Namespace: testNamespace}, &appsv1.StatefulSet{}); err == nil {
+		t.Error("managed Zookeeper is deployed with TLS in spec")
+	}
+}
+
+func TestReconcileWaitsForZookeeper(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(unusedAddress(t)))
+
+	result := r.reconcile(t)
+	if result.RequeueAfter != r.options.ZookeeperBackoffBase {
+		t.Errorf("expected requeue after %s, got %+v", r.options.ZookeeperBackoffBase, result)
+	}
+
+	sts := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-kafka", Namespace: testNamespace}, sts)
+	if err == nil {
+		t.Error("StatefulSet is created before zookeeper is ready")
+	}
+	// Services do not need zookeeper
+	r.get(t, "test-kafka", &corev1.Service{})
+
+	condition := r.getKafkaCluster(t).Status.GetCondition(litekafkav1alpha1.ConditionZookeeperReady)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "Unreachable" {
+		t.Errorf("unexpected ZookeeperReady condition %+v", condition)
+	}
+	select {
+	case event := <-r.recorder.Events:
+		t.Logf("event: %s", event)
+	default:
+		t.Error("expected event of unavailable zookeeper")
+	}
+}
+
+func TestReconcileUpdatesStatefulSet(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.reconcile(t)
+
+	kafka := r.getKafkaCluster(t)
+	kafka.Spec.Image = "confluentinc/cp-kafka:5.3.1"
+	kafka.Spec.Replicas = 5
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+
+	sts := &appsv1.StatefulSet{}
+	r.get(t, "test-kafka", sts)
+	if *sts.Spec.Replicas != 5 {
+		t.Errorf("expected 5 replicas, got %d", *sts.Spec.Replicas)
+	}
+	if image := sts.Spec.Template.Spec.Containers[0].Image; image != kafka.Spec.Image {
+		t.Errorf("expected image %s, got %s", kafka.Spec.Image, image)
+	}
+}
+
+func TestReconcileRecreatesPodDisruptionBudget(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.reconcile(t)
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	r.get(t, "test-kafka", pdb)
+	if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Fatalf("expected default maxUnavailable 1, got %v", pdb.Spec.MaxUnavailable)
+	}
+	r.events()
+
+	// Spec of PodDisruptionBudget is immutable, it is recreated with new maxUnavailable
+	kafka := r.getKafkaCluster(t)
+	maxUnavailable := intstr.FromString("50%")
+	kafka.Spec.DisruptionBudget = &litekafkav1alpha1.DisruptionBudgetSpec{MaxUnavailable: &maxUnavailable}
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	r.get(t, "test-kafka", pdb)
+	if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.String() != "50%" {
+		t.Errorf("expected maxUnavailable 50%%, got %v", pdb.Spec.MaxUnavailable)
+	}
+	if len(pdb.OwnerReferences) != 1 || pdb.OwnerReferences[0].Name != testName {
+		t.Errorf("expected recreated PodDisruptionBudget owned by cluster, got %+v", pdb.OwnerReferences)
+	}
+	expected := "Normal Updated Updated PodDisruptionBudget test-kafka: recreated with maxUnavailable 50%"
+	if events := r.events(); len(events) == 0 || events[0] != expected {
+		t.Errorf("expected event %q, got %q", expected, events)
+	}
+
+	// Unchanged PodDisruptionBudget is kept
+	r.reconcile(t)
+	for _, event := range r.events() {
+		if strings.Contains(event, "PodDisruptionBudget") {
+			t.Errorf("unchanged PodDisruptionBudget is recreated: %q", event)
+		}
+	}
+}
+
+func TestReconcileKeepsBrokerIDsOnScaling(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.reconcile(t)
+
+	// Pod 1 was replaced by broker with new ID
+	configMap := &corev1.ConfigMap{}
+	r.get(t, "test-kafka-broker-ids", configMap)
+	configMap.Data["test-kafka-1"] = "7"
+	if err := r.client.Update(context.TODO(), configMap); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scaling := range []struct {
+		replicas int32
+		expected map[string]string
+	}{
+		{
+			replicas: 1,
+			expected: map[string]string{"test-kafka-0": "0", "test-kafka-1": "7", "test-kafka-2": "2"},
+		},
+		{
+			replicas: 4,
+			expected: map[string]string{"test-kafka-0": "0", "test-kafka-1": "7", "test-kafka-2": "2", "test-kafka-3": "3"},
+		},
+	} {
+		kafka := r.getKafkaCluster(t)
+		kafka.Spec.Replicas = scaling.replicas
+		if err := r.client.Update(context.TODO(), kafka); err != nil {
+			t.Fatal(err)
+		}
+		r.reconcile(t)
+
+		r.get(t, "test-kafka-broker-ids", configMap)
+		if !reflect.DeepEqual(configMap.Data, scaling.expected) {
+			t.Errorf("expected broker IDs %v with %d replicas, got %v", scaling.expected, scaling.replicas, configMap.Data)
+		}
+	}
+}
+
+func TestReconcileRecordsEvents(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.reconcile(t)
+
+	expected := []string{
+		"Normal Created Created Service test-kafka-headless",
+		"Normal Created Created Service test-kafka",
+		"Normal Created Created PodDisruptionBudget test-kafka",
+		"Normal Created Created ConfigMap test-kafka-broker-ids",
+		"Normal ZookeeperReady Zookeeper quorum is available",
+		"Normal Created Created StatefulSet test-kafka",
+		"Normal Healthy All brokers are registered and all partitions are in sync",
+	}
+	if events := r.events(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+
+	// Unchanged cluster does not record events
+	r.reconcile(t)
+	if events := r.events(); len(events) > 0 {
+		t.Errorf("expected no events, got %q", events)
+	}
+
+	kafka := r.getKafkaCluster(t)
+	kafka.Spec.Replicas = 5
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	expected = []string{
+		"Normal Updated Updated ConfigMap test-kafka-broker-ids: IDs of new brokers added",
+		"Normal Scaled Scaled StatefulSet test-kafka: replicas 3 -> 5",
+		"Warning BrokersUnavailable 3 of 5 brokers are registered in cluster",
+	}
+	if events := r.events(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestDeleteResourceRecordsEvents(t *testing.T) {
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-kafka-metrics", Namespace: testNamespace}}
+	r := newTestReconciler(t, kafka, configMap.DeepCopy())
+
+	for i := 0; i < 2; i++ {
+		if err := r.deleteResource(kafka, configMap.DeepCopy(), "ConfigMap", configMap.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Second delete does not find ConfigMap
+	expected := []string{"Normal Deleted Deleted ConfigMap test-kafka-metrics"}
+	if events := r.events(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestReconcileMonitoring(t *testing.T) {
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	kafka.Spec.Metrics = &litekafkav1alpha1.MetricsSpec{MonitorLabels: map[string]string{"prometheus": "kafka"}}
+	r := newTestReconciler(t, kafka)
+
+	// Resources of prometheus-operator are not created when it is not installed
+	r.reconcile(t)
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-kafka", Namespace: testNamespace}, &monitoringv1.ServiceMonitor{}); err == nil {
+		t.Error("ServiceMonitor is created without prometheus-operator")
+	}
+	r.events()
+
+	r.monitoring = map[string]bool{monitoringv1.ServiceMonitorsKind: true, monitoringv1.PrometheusRuleKind: true}
+	r.reconcile(t)
+	serviceMonitor := &monitoringv1.ServiceMonitor{}
+	r.get(t, "test-kafka", serviceMonitor)
+	if serviceMonitor.Labels["prometheus"] != "kafka" || len(serviceMonitor.OwnerReferences) != 1 {
+		t.Errorf("expected ServiceMonitor with monitor labels owned by cluster, got %+v", serviceMonitor.ObjectMeta)
+	}
+	rule := &monitoringv1.PrometheusRule{}
+	r.get(t, "test-kafka", rule)
+	if len(rule.Spec.Groups) == 0 || rule.Labels["prometheus"] != "kafka" {
+		t.Errorf("expected PrometheusRule with alerts and monitor labels, got %+v", rule)
+	}
+	expected := []string{"Normal Created Created ServiceMonitor test-kafka", "Normal Created Created PrometheusRule test-kafka"}
+	if events := r.events(); len(events) < 2 || !reflect.DeepEqual(events[:2], expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+
+	// Changed resources are repaired
+	serviceMonitor.Spec.Endpoints = nil
+	if err := r.client.Update(context.TODO(), serviceMonitor); err != nil {
+		t.Fatal(err)
+	}
+	rule.Labels = nil
+	if err := r.client.Update(context.TODO(), rule); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	r.get(t, "test-kafka", serviceMonitor)
+	if len(serviceMonitor.Spec.Endpoints) != 1 {
+		t.Errorf("expected endpoint of ServiceMonitor to be restored, got %+v", serviceMonitor.Spec.Endpoints)
+	}
+	r.get(t, "test-kafka", rule)
+	if rule.Labels["prometheus"] != "kafka" {
+		t.Errorf("expected labels of PrometheusRule to be restored, got %v", rule.Labels)
+	}
+	expected = []string{
+		"Normal Updated Updated ServiceMonitor test-kafka: spec changed",
+		"Normal Updated Updated PrometheusRule test-kafka: spec changed",
+	}
+	if events := r.events(); len(events) < 2 || !reflect.DeepEqual(events[:2], expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+
+	// Resources are deleted when metrics are disabled
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.Metrics = nil
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	for _, obj := range []runtime.Object{&monitoringv1.ServiceMonitor{}, &monitoringv1.PrometheusRule{}} {
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "test-kafka", Namespace: testNamespace}, obj); err == nil {
+			t.Errorf("expected %T to be deleted", obj)
+		}
+	}
+	expected = []string{"Normal Deleted Deleted ServiceMonitor test-kafka", "Normal Deleted Deleted PrometheusRule test-kafka"}
+	if events := r.events(); len(events) < 2 || !reflect.DeepEqual(events[:2], expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestReconcileRecordsMetrics(t *testing.T) {
+	kafka := newTestKafkaCluster(unusedAddress(t))
+	kafka.Name = "metrics"
+	r := newTestReconciler(t, kafka)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: kafka.Name, Namespace: testNamespace}}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := []struct {
+		collector prometheus.Collector
+		expected  float64
+	}{
+		{reconcileTotal.WithLabelValues(testNamespace, kafka.Name, phaseServices, "success"), 1},
+		{reconcileTotal.WithLabelValues(testNamespace, kafka.Name, phaseZookeeper, "success"), 1},
+		{reconcileTotal.WithLabelValues(testNamespace, kafka.Name, phaseBrokers, "success"), 0},
+		{zookeeperReady.WithLabelValues(testNamespace, kafka.Name), 0},
+		{brokersDesired.WithLabelValues(testNamespace, kafka.Name), 3},
+		{brokersReady.WithLabelValues(testNamespace, kafka.Name), 0},
+	}
+	for i, m := range metrics {
+		if value := testutil.ToFloat64(m.collector); value != m.expected {
+			t.Errorf("metric %d: expected %v, got %v", i, m.expected, value)
+		}
+	}
+
+	// Metrics of deleted cluster are removed
+	if err := r.client.Delete(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if brokersDesired.DeleteLabelValues(testNamespace, kafka.Name) {
+		t.Error("metrics of deleted cluster are not removed")
+	}
+}
+
+func TestObserveRollingRestart(t *testing.T) {
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	kafka.Name = "rolling"
+	r := newTestReconciler(t, kafka)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: kafka.Name, Namespace: testNamespace}}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	rolling := operationInProgress.WithLabelValues(testNamespace, kafka.Name, operationRollingRestart)
+
+	// Current revision of StatefulSet with OnDelete strategy is never advanced
+	r.rollOut(t, "rolling-kafka")
+	r.observeClusterState(kafka)
+	if value := testutil.ToFloat64(rolling); value != 0 {
+		t.Errorf("expected no rolling restart after pods are updated, got %v", value)
+	}
+
+	sts := &appsv1.StatefulSet{}
+	r.get(t, "rolling-kafka", sts)
+	sts.Annotations[templateHashAnnotation] = "changed-template-hash"
+	if err := r.client.Update(context.TODO(), sts); err != nil {
+		t.Fatal(err)
+	}
+	r.syncStatefulSet(t, "rolling-kafka")
+	r.observeClusterState(kafka)
+	if value := testutil.ToFloat64(rolling); value != 1 {
+		t.Errorf("expected rolling restart while pods are in old revision, got %v", value)
+	}
+}
+
+func TestReconcileSetsRack(t *testing.T) {
+	const zoneLabel = "failure-domain.beta.kubernetes.io/zone"
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	kafka.Spec.Replicas = 2
+	kafka.Spec.Rack = &litekafkav1alpha1.RackSpec{TopologyKey: zoneLabel}
+	labeled := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{zoneLabel: "zone-a"}}}
+	unlabeled := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}
+	r := newTestReconciler(t, kafka, labeled, unlabeled)
+	r.reconcile(t)
+	r.rollOut(t, "test-kafka")
+	for i, node := range []string{"node-a", "node-b"} {
+		pod := &corev1.Pod{}
+		r.get(t, fmt.Sprintf("test-kafka-%d", i), pod)
+		pod.Spec.NodeName = node
+		if err := r.client.Update(context.TODO(), pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.events()
+
+	// Rack is taken from label of node, broker on node without label is left without rack annotation
+	r.reconcile(t)
+	rackOf := func(name string) (string, bool) {
+		pod := &corev1.Pod{}
+		r.get(t, name, pod)
+		rack, ok := pod.Annotations[rackAnnotation]
+		return rack, ok
+	}
+	if rack, ok := rackOf("test-kafka-0"); !ok || rack != "zone-a" {
+		t.Errorf("expected rack zone-a of test-kafka-0, got %q", rack)
+	}
+	if rack, ok := rackOf("test-kafka-1"); ok {
+		t.Errorf("expected no rack of test-kafka-1 on node without label, got %q", rack)
+	}
+	expected := []string{
+		`Normal RackAssigned Set rack "zone-a" of broker pod test-kafka-0 from node node-a`,
+		"Warning RackMissing Node node-b of broker pod test-kafka-1 has no label " + zoneLabel + ", broker waits for rack",
+		"Normal WaitingForRack Waiting for broker pods to be scheduled and get rack",
+	}
+	if events := r.events(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+
+	// Rack is set also while cluster is paused, so restarted broker can start
+	kafka = r.getKafkaCluster(t)
+	kafka.Spec.Paused = true
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	unlabeled.Labels = map[string]string{zoneLabel: "zone-b"}
+	if err := r.client.Update(context.TODO(), unlabeled); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	if rack, ok := rackOf("test-kafka-1"); !ok || rack != "zone-b" {
+		t.Errorf("expected rack zone-b of test-kafka-1 while paused, got %q", rack)
+	}
+}
+
+func TestReconcilePaused(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.reconcile(t)
+
+	kafka := r.getKafkaCluster(t)
+	kafka.Annotations = map[string]string{litekafkav1alpha1.PausedAnnotation: "true"}
+	kafka.Spec.Replicas = 5
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.events()
+	r.statusUpdates()
+	r.reconcile(t)
+
+	// Condition, zookeeper check and health are written together
+	if updates := r.statusUpdates(); updates != 1 {
+		t.Errorf("expected status written once, got %d", updates)
+	}
+	sts := &appsv1.StatefulSet{}
+	r.get(t, "test-kafka", sts)
+	if *sts.Spec.Replicas != 3 {
+		t.Errorf("paused cluster is scaled to %d replicas", *sts.Spec.Replicas)
+	}
+	kafka = r.getKafkaCluster(t)
+	if !kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionPaused) {
+		t.Errorf("cluster is not paused: %+v", kafka.Status.GetCondition(litekafkav1alpha1.ConditionPaused))
+	}
+	// Status is still updated
+	if kafka.Status.Health == nil || !kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionZookeeperReady) {
+		t.Errorf("status of paused cluster is not updated: %+v", kafka.Status)
+	}
+	expected := []string{
+		"Normal Paused Reconcile is paused by annotation " + litekafkav1alpha1.PausedAnnotation,
+		"Warning BrokersUnavailable 3 of 5 brokers are registered in cluster",
+	}
+	if events := r.events(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+
+	delete(kafka.Annotations, litekafkav1alpha1.PausedAnnotation)
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+
+	r.get(t, "test-kafka", sts)
+	if *sts.Spec.Replicas != 5 {
+		t.Errorf("expected 5 replicas after resume, got %d", *sts.Spec.Replicas)
+	}
+	condition := r.getKafkaCluster(t).Status.GetCondition(litekafkav1alpha1.ConditionPaused)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "Resumed" {
+		t.Errorf("unexpected Paused condition %+v", condition)
+	}
+	if events := r.events(); len(events) == 0 || events[0] != "Normal Resumed Reconcile is resumed, changes of spec are applied" {
+		t.Errorf("expected resume event, got %q", events)
+	}
+}
+
+func TestReconcileDeletion(t *testing.T) {
+	claims := []runtime.Object{}
+	for _, instance := range []string{testName, "other"} {
+		claims = append(claims, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name:      "data-" + instance + "-kafka-0",
+			Namespace: testNamespace,
+			Labels:    map[string]string{"app.kubernetes.io/name": "kafka", "app.kubernetes.io/instance": instance},
+		}})
+	}
+	kafka := newTestKafkaCluster(startFakeZookeeper(t))
+	kafka.Spec.Deletion = &litekafkav1alpha1.DeletionSpec{PersistentVolumeClaims: litekafkav1alpha1.PersistentVolumeClaimsDelete}
+	r := newTestReconciler(t, append(claims, kafka)...)
+	r.reconcile(t)
+	kafka = r.getKafkaCluster(t)
+	if len(kafka.Finalizers) != 1 || kafka.Finalizers[0] != teardownFinalizer {
+		t.Fatalf("expected teardown finalizer, got %v", kafka.Finalizers)
+	}
+
+	// Fake client does not wait for finalizers, deletion is simulated by timestamp
+	now := metav1.Now()
+	kafka.DeletionTimestamp = &now
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	sts := &appsv1.StatefulSet{}
+	for replicas := int32(2); replicas >= 0; replicas-- {
+		r.reconcile(t)
+		r.get(t, "test-kafka", sts)
+		if *sts.Spec.Replicas != replicas {
+			t.Fatalf("expected brokers scaled down to %d, got %d", replicas, *sts.Spec.Replicas)
+		}
+	}
+	r.reconcile(t)
+
+	kafka = r.getKafkaCluster(t)
+	if len(kafka.Finalizers) > 0 {
+		t.Errorf("finalizer is not removed: %v", kafka.Finalizers)
+	}
+	if kafka.Spec.ServicePort != nil || kafka.Spec.Deletion.DeleteZookeeperData {
+		t.Errorf("spec is changed by teardown: %+v", kafka.Spec)
+	}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: "data-test-kafka-0", Namespace: testNamespace}, &corev1.PersistentVolumeClaim{})
+	if err == nil {
+		t.Error("PersistentVolumeClaim of cluster is not deleted")
+	}
+	r.get(t, "data-other-kafka-0", &corev1.PersistentVolumeClaim{})
+}
+
+func TestReconcileDeletionPaused(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.reconcile(t)
+	kafka := r.getKafkaCluster(t)
+	kafka.Spec.Paused = true
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	r.events()
+
+	now := metav1.Now()
+	kafka = r.getKafkaCluster(t)
+	kafka.DeletionTimestamp = &now
+	if err := r.client.Update(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	r.reconcile(t)
+	message := "Reconcile is paused by spec.paused, teardown of deleted cluster waits until reconcile is resumed"
+	if events := r.events(); len(events) == 0 || events[0] != "Normal Paused "+message {
+		t.Errorf("expected event %q, got %q", message, events)
+	}
+	kafka = r.getKafkaCluster(t)
+	if condition := kafka.Status.GetCondition(litekafkav1alpha1.ConditionPaused); condition == nil || condition.Message != message {
+		t.Errorf("expected Paused condition %q, got %+v", message, condition)
+	}
+	if len(kafka.Finalizers) != 1 {
+		t.Errorf("expected teardown to wait, got finalizers %v", kafka.Finalizers)
+	}
+	sts := &appsv1.StatefulSet{}
+	r.get(t, "test-kafka", sts)
+	if *sts.Spec.Replicas != 3 {
+		t.Errorf("brokers of paused cluster are scaled down to %d", *sts.Spec.Replicas)
+	}
+
+	// Event is recorded once
+	r.reconcile(t)
+	for _, event := range r.events() {
+		if strings.HasPrefix(event, "Normal Paused") {
+			t.Errorf("unexpected repeated event %q", event)
+		}
+	}
+}
+
+func TestReconcileReportsOfflinePartitions(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.admin.Topics["orders"] = map[int32][]int32{0: {0, 1}, 1: {3}}
+
+	r.reconcile(t)
+
+	kafka := r.getKafkaCluster(t)
+	condition := kafka.Status.GetCondition(litekafkav1alpha1.ConditionHealthy)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "OfflinePartitions" {
+		t.Errorf("unexpected Healthy condition %+v", condition)
+	}
+	if kafka.Status.Health == nil || kafka.Status.Health.OfflinePartitions != 1 {
+		t.Errorf("expected 1 offline partition, got %+v", kafka.Status.Health)
+	}
+}
+
+func TestReconcileReportsControlledShutdownDisabled(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.admin.Configs[kafka.ConfigResource{Type: kafka.ResourceTypeBroker, Name: "1"}] = map[string]string{
+		"controlled.shutdown.enable": "false",
+	}
+
+	r.reconcile(t)
+
+	health := r.getKafkaCluster(t).Status.Health
+	if health == nil || !reflect.DeepEqual(health.ControlledShutdownDisabled, []int32{1}) {
+		t.Errorf("expected controlled shutdown disabled on broker 1, got %+v", health)
+	}
+	expected := "Warning ControlledShutdownDisabled Brokers [1] have controlled.shutdown.enable=false, they stop without moving leadership of partitions"
+	found := false
+	for _, event := range r.events() {
+		found = found || event == expected
+	}
+	if !found {
+		t.Errorf("expected event %q", expected)
+	}
+}
+
+func TestReconcileReportsUnreachableCluster(t *testing.T) {
+	r := newTestReconciler(t, newTestKafkaCluster(startFakeZookeeper(t)))
+	r.admin.Err = io.EOF
+
+	r.reconcile(t)
+
+	kafka := r.getKafkaCluster(t)
+	condition := kafka.Status.GetCondition(litekafkav1alpha1.ConditionHealthy)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "Unreachable" {
+		t.Errorf("unexpected Healthy condition %+v", condition)
+	}
+	if kafka.Status.Health != nil {
+		t.Errorf("expected no health in status, got %+v", kafka.Status.Health)
+	}
+}
+
+func TestReconcileConcurrently(t *testing.T) {
+	address := startFakeZookeeper(t)
+	names := []string{"alpha", "beta", "gamma", "delta"}
+	objs := []runtime.Object{}
+	for _, name := range names {
+		kafka := newTestKafkaCluster(address)
+		kafka.Name = name
+		kafka.Spec.Replicas = int32(len(name))
+		objs = append(objs, kafka)
+	}
+	r := newTestReconciler(t, objs...)
+
+	// Reconciler does not keep state of request, so clusters can be reconciled in parallel
+	errs := make(chan error, len(names))
+	for _, name := range names {
+		go func(name string) {
+			_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: testNamespace}})
+			errs <- err
+		}(name)
+	}
+	for range names {
+		if err := <-errs; err != nil {
+			t.Fatalf("reconcile failed: %v", err)
+		}
+	}
+
+	for _, name := range names {
+		sts := &appsv1.StatefulSet{}
+		r.get(t, name+"-kafka", sts)
+		if *sts.Spec.Replicas != int32(len(name)) || sts.OwnerReferences[0].Name != name {
+			t.Errorf("StatefulSet %s does not belong to its cluster: replicas %d, owner %s", sts.Name, *sts.Spec.Replicas, sts.OwnerReferences[0].Name)
+		}
+	}
+}
+
+func TestGetPodKafkaCluster(t *testing.T) {
+	pods := []struct {
+		labels   map[string]string
+		expected []reconcile.Request
+	}{
+		{
+			labels:   map[string]string{"app.kubernetes.io/name": "kafka", "app.kubernetes.io/instance": testName},
+			expected: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}},
+		},
+		{
+			labels:   map[string]string{"app.kubernetes.io/name": "zookeeper", "app.kubernetes.io/instance": testName},
+			expected: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNamespace}}},
+		},
+		{labels: map[string]string{"app.kubernetes.io/name": "nginx", "app.kubernetes.io/instance": testName}},
+		{labels: map[string]string{"app.kubernetes.io/name": "kafka"}},
+	}
+	for _, p := range pods {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: testNamespace, Labels: p.labels}}
+		requests := getPodKafkaCluster(handler.MapObject{Meta: pod, Object: pod})
+		if !reflect.DeepEqual(requests, p.expected) {
+			t.Errorf("pod with labels %v: expected %v, got %v", p.labels, p.expected, requests)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package kafkacluster
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// kraftControllerIDOffset is added to ordinal of dedicated controller to get its node.id
+	kraftControllerIDOffset = 9000
+	// kraftCombinedVoters is maximal number of brokers which are also controllers
+	kraftCombinedVoters = 3
+	// brokerModeMigration is a mode of brokers registered both in zookeeper and in KRaft quorum
+	brokerModeMigration = "migration"
+)
+
+// getBrokerMode returns mode of brokers configuration, during migration it follows migration phase
+func getBrokerMode(kafka *litekafkav1alpha1.KafkaCluster) string {
+	switch kafka.Status.GetMigrationPhase() {
+	case litekafkav1alpha1.MigrationPhaseControllers, litekafkav1alpha1.MigrationPhaseRollingBack:
+		return litekafkav1alpha1.ModeZookeeper
+	case litekafkav1alpha1.MigrationPhaseBrokersMigration, litekafkav1alpha1.MigrationPhaseRollingBackBrokers:
+		return brokerModeMigration
+	case litekafkav1alpha1.MigrationPhaseBrokersKRaft, litekafkav1alpha1.MigrationPhaseFinalizing:
+		return litekafkav1alpha1.ModeKRaft
+	}
+	if len(kafka.Status.Mode) > 0 {
+		return kafka.Status.Mode
+	}
+	return kafka.Spec.Mode
+}
+
+// isControllerMigrating returns true when KRaft controllers copy metadata to zookeeper
+func isControllerMigrating(kafka *litekafkav1alpha1.KafkaCluster) bool {
+	switch kafka.Status.GetMigrationPhase() {
+	case litekafkav1alpha1.MigrationPhaseControllers, litekafkav1alpha1.MigrationPhaseBrokersMigration,
+		litekafkav1alpha1.MigrationPhaseBrokersKRaft, litekafkav1alpha1.MigrationPhaseRollingBackBrokers:
+		return true
+	}
+	return false
+}
+
+// generateClusterID returns random cluster ID in format of kafka-storage random-uuid
+func generateClusterID() (string, error) {
+	for {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", err
+		}
+		clusterID := base64.RawURLEncoding.EncodeToString(id)
+		// IDs starting with dash are not accepted by command line tools
+		if !strings.HasPrefix(clusterID, "-") {
+			return clusterID, nil
+		}
+	}
+}
+
+// newKRaftStatus returns quorum of controllers for spec, it is recorded in status when quorum is formed
+func newKRaftStatus(kafka *litekafkav1alpha1.KafkaCluster) *litekafkav1alpha1.KRaftStatus {
+	quorum := &litekafkav1alpha1.KRaftStatus{
+		ControllerReplicas: kafka.Spec.KRaft.ControllerReplicas,
+		Voters:             kafka.Spec.KRaft.ControllerReplicas,
+	}
+	if quorum.ControllerReplicas == 0 {
+		quorum.Voters = kraftCombinedVoters
+		if kafka.Spec.Replicas < kraftCombinedVoters {
+			quorum.Voters = kafka.Spec.Replicas
+		}
+	}
+	return quorum
+}
+
+// getKRaftVotersCount returns number of controllers in quorum, recorded quorum is kept when brokers are scaled
+func getKRaftVotersCount(kafka *litekafkav1alpha1.KafkaCluster) int32 {
+	if kafka.Status.KRaft != nil {
+		return kafka.Status.KRaft.Voters
+	}
+	return newKRaftStatus(kafka).Voters
+}
+
+// getKRaftVoters returns controller.quorum.voters from DNS names of headless Service
+func getKRaftVoters(kafka *litekafkav1alpha1.KafkaCluster) string {
+	voters := []string{}
+	for i := int32(0); i < getKRaftVotersCount(kafka); i++ {
+		if kafka.Spec.KRaft.ControllerReplicas > 0 {
+			voters = append(voters, fmt.Sprintf("%d@%s-controller-%d.%s-controller-headless.%s.svc:%d",
+				kraftControllerIDOffset+i, kafka.Name, i, kafka.Name, kafka.Namespace, kafka.Spec.KRaft.ControllerPort.Port))
+		} else {
+			voters = append(voters, fmt.Sprintf("%d@%s-kafka-%d.%s-kafka-headless.%s.svc:%d",
+				i, kafka.Name, i, kafka.Name, kafka.Namespace, kafka.Spec.KRaft.ControllerPort.Port))
+		}
+	}
+	return strings.Join(voters, ",")
+}
+
+// getKRaftEnv returns configuration shared by brokers and controllers in KRaft mode,
+// storage is formatted with CLUSTER_ID by the image on start
+func getKRaftEnv(kafka *litekafkav1alpha1.KafkaCluster) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name:  "CLUSTER_ID",
+			Value: kafka.Status.ClusterID,
+		},
+		{
+			Name:  "KAFKA_CONTROLLER_QUORUM_VOTERS",
+			Value: getKRaftVoters(kafka),
+		},
+		{
+			Name:  "KAFKA_CONTROLLER_LISTENER_NAMES",
+			Value: "CONTROLLER",
+		},
+		{
+			Name:  "KAFKA_LISTENER_SECURITY_PROTOCOL_MAP",
+			Value: "PLAINTEXT:PLAINTEXT,CONTROLLER:PLAINTEXT",
+		},
+		{
+			Name:  "KAFKA_INTER_BROKER_LISTENER_NAME",
+			Value: "PLAINTEXT",
+		},
+	}
+}
+
+func getKafkaControllerStatefulSet(kafka *litekafkav1alpha1.KafkaCluster) *appsv1.StatefulSet {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-controller",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "kafka-controller",
+			"app.kubernetes.io/name":      "kafka",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+	selectors := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app.kubernetes.io/component": "kafka-controller",
+			"app.kubernetes.io/name":      "kafka",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+	replicas := kafka.Spec.KRaft.ControllerReplicas
+	probe := &corev1.Probe{
+		Handler: corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt(int(kafka.Spec.KRaft.ControllerPort.Port)),
+			},
+		},
+		InitialDelaySeconds: 30,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      5,
+	}
+	volumeClaimTemplate := []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "datadir",
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse(kafka.Spec.KRaft.ControllerStorage),
+					},
+				},
+			},
+		},
+	}
+	envVars := []corev1.EnvVar{
+		{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: "metadata.name",
+				},
+			},
+		},
+		{
+			Name:  "KAFKA_HEAP_OPTS",
+			Value: "-Xmx512M -Xms512M",
+		},
+		{
+			Name:  "KAFKA_PROCESS_ROLES",
+			Value: "controller",
+		},
+		{
+			Name:  "KAFKA_LISTENERS",
+			Value: fmt.Sprintf("CONTROLLER://0.0.0.0:%d", kafka.Spec.KRaft.ControllerPort.Port),
+		},
+		{
+			Name:  "KAFKA_LOG_DIRS",
+			Value: "/opt/kafka/data/logs",
+		},
+		{
+			Name:  "KAFKA_CONFLUENT_SUPPORT_METRICS_ENABLE",
+			Value: "false",
+		},
+	}
+	envVars = append(envVars, getKRaftEnv(kafka)...)
+	volumes := []corev1.Volume{}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "datadir",
+			MountPath: "/opt/kafka/data",
+		},
+	}
+	startCmd := `export KAFKA_NODE_ID=$((` + fmt.Sprintf("%d", kraftControllerIDOffset) + ` + ${POD_NAME##*-}))`
+	if isControllerMigrating(kafka) {
+		// Controllers copy metadata from zookeeper and keep writing them there until finalization
+		envVars = append(envVars, []corev1.EnvVar{
+			{
+				Name:  "KAFKA_ZOOKEEPER_METADATA_MIGRATION_ENABLE",
+				Value: "true",
+			},
+			{
+				Name:  "KAFKA_ZOOKEEPER_CONNECT",
+				Value: kafka.Spec.Zookeeper.GetConnectString(),
+			},
+		}...)
+		zkEnvVars, zkVolumes, zkVolumeMounts, zkCmd := getZookeeperSecurityConfig(kafka)
+		envVars = append(envVars, zkEnvVars...)
+		volumes = append(volumes, zkVolumes...)
+		volumeMounts = append(volumeMounts, zkVolumeMounts...)
+		startCmd += zkCmd
+	}
+	startCmd += ` && exec /etc/confluent/docker/run`
+
+	sts := appsv1.StatefulSet{
+		ObjectMeta: metaData,
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            &replicas,
+			Selector:            selectors,
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			ServiceName:         kafka.Name + "-controller-headless",
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: "OnDelete",
+			},
+			VolumeClaimTemplates: volumeClaimTemplate,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metaData,
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: kafka.Spec.TerminationGracePeriodSeconds,
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+								{
+									Weight: 100,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: selectors,
+										TopologyKey:   "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            "kafka-controller",
+							Image:           kafka.Spec.Image,
+							ImagePullPolicy: "IfNotPresent",
+							LivenessProbe:   probe,
+							ReadinessProbe:  probe,
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          kafka.Spec.KRaft.ControllerPort.Name,
+									ContainerPort: kafka.Spec.KRaft.ControllerPort.Port,
+								},
+							},
+							Env: envVars,
+							Command: []string{
+								`sh`,
+								`-exc`,
+								startCmd,
+							},
+							VolumeMounts: volumeMounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+	if kafka.Spec.Metrics != nil {
+		// Controller metrics, e.g. offline partitions, are reported only by controllers
+		container := &sts.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "KAFKA_JMX_PORT",
+			Value: fmt.Sprintf("%d", kafka.Spec.Options.JXMPort),
+		})
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			Name:          "jmx",
+			ContainerPort: int32(kafka.Spec.Options.JXMPort),
+		})
+		addJMXExporter(kafka, &sts.Spec.Template.Spec)
+	}
+	sts.Annotations = map[string]string{
+		templateHashAnnotation: getPodTemplateHash(&sts.Spec.Template),
+	}
+	return &sts
+}
+
+func getKafkaControllerServiceHeadless(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Service {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-controller-headless",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "kafka-controller",
+			"app.kubernetes.io/name":      "kafka",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+
+	service := corev1.Service{
+		ObjectMeta: metaData,
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name: kafka.Spec.KRaft.ControllerPort.Name,
+					Port: kafka.Spec.KRaft.ControllerPort.Port,
+				},
+			},
+			ClusterIP:                "None",
+			PublishNotReadyAddresses: true,
+			Selector: map[string]string{
+				"app.kubernetes.io/component": "kafka-controller",
+				"app.kubernetes.io/name":      "kafka",
+				"app.kubernetes.io/instance":  kafka.Name,
+			},
+		},
+	}
+
+	return &service
+}
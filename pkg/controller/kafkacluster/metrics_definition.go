@@ -0,0 +1,243 @@
+package kafkacluster
+
+import (
+	"fmt"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	jmxExporterConfigDir = "/etc/jmx-exporter"
+	jmxExporterAgentDir  = "/opt/jmx-exporter"
+)
+
+// jmxExporterRules is a default ruleset of JMX exporter, it exports gauges and counters of Kafka MBeans
+const jmxExporterRules = `lowercaseOutputName: true
+rules:
+- pattern: kafka.server<type=(.+), name=(.+), clientId=(.+), topic=(.+), partition=(.*)><>Value
+  name: kafka_server_$1_$2
+  type: GAUGE
+  labels:
+    clientId: "$3"
+    topic: "$4"
+    partition: "$5"
+- pattern: kafka.server<type=(.+), name=(.+), clientId=(.+), brokerHost=(.+), brokerPort=(.+)><>Value
+  name: kafka_server_$1_$2
+  type: GAUGE
+  labels:
+    clientId: "$3"
+    broker: "$4:$5"
+- pattern: kafka.(\w+)<type=(.+), name=(.+)PerSec\w*, (.+)=(.+), (.+)=(.+)><>Count
+  name: kafka_$1_$2_$3_total
+  type: COUNTER
+  labels:
+    "$4": "$5"
+    "$6": "$7"
+- pattern: kafka.(\w+)<type=(.+), name=(.+)PerSec\w*, (.+)=(.+)><>Count
+  name: kafka_$1_$2_$3_total
+  type: COUNTER
+  labels:
+    "$4": "$5"
+- pattern: kafka.(\w+)<type=(.+), name=(.+)PerSec\w*><>Count
+  name: kafka_$1_$2_$3_total
+  type: COUNTER
+- pattern: kafka.(\w+)<type=(.+), name=(.+), (.+)=(.+), (.+)=(.+)><>Value
+  name: kafka_$1_$2_$3
+  type: GAUGE
+  labels:
+    "$4": "$5"
+    "$6": "$7"
+- pattern: kafka.(\w+)<type=(.+), name=(.+), (.+)=(.+)><>Value
+  name: kafka_$1_$2_$3
+  type: GAUGE
+  labels:
+    "$4": "$5"
+- pattern: kafka.(\w+)<type=(.+), name=(.+)><>Value
+  name: kafka_$1_$2_$3
+  type: GAUGE
+- pattern: kafka.(\w+)<type=(.+), name=(.+), (.+)=(.+)><>Count
+  name: kafka_$1_$2_$3_count
+  type: COUNTER
+  labels:
+    "$4": "$5"
+- pattern: kafka.(\w+)<type=(.+), name=(.+)><>Count
+  name: kafka_$1_$2_$3_count
+  type: COUNTER
+`
+
+// getMetricsConfigMapName returns name of ConfigMap with JMX exporter configuration
+func getMetricsConfigMapName(kafka *litekafkav1alpha1.KafkaCluster) string {
+	if len(kafka.Spec.Metrics.ConfigMapName) > 0 {
+		return kafka.Spec.Metrics.ConfigMapName
+	}
+	return kafka.Name + "-kafka-metrics"
+}
+
+// getJMXExporterConfig returns default configuration of JMX exporter,
+// sidecar reads MBeans from JMX port of broker while javaagent reads them in process
+func getJMXExporterConfig(kafka *litekafkav1alpha1.KafkaCluster) string {
+	if kafka.Spec.Metrics.Mode == litekafkav1alpha1.MetricsModeJavaAgent {
+		return jmxExporterRules
+	}
+	return fmt.Sprintf("hostPort: localhost:%d\n", kafka.Spec.Options.JXMPort) + jmxExporterRules
+}
+
+// getJMXExporterSidecar returns container running JMX exporter HTTP server
+func getJMXExporterSidecar(kafka *litekafkav1alpha1.KafkaCluster) corev1.Container {
+	return corev1.Container{
+		Name:            "jmx-exporter",
+		Image:           kafka.Spec.Metrics.Image,
+		ImagePullPolicy: "IfNotPresent",
+		Command: []string{
+			"java",
+			"-jar",
+			kafka.Spec.Metrics.JarPath,
+			fmt.Sprintf("%d", kafka.Spec.Metrics.Port.Port),
+			jmxExporterConfigDir + "/config.yml",
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          kafka.Spec.Metrics.Port.Name,
+				ContainerPort: kafka.Spec.Metrics.Port.Port,
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "jmx-exporter-config",
+				MountPath: jmxExporterConfigDir,
+			},
+		},
+	}
+}
+
+// getJMXExporterAgentInit returns init container copying JMX exporter javaagent into broker pod
+func getJMXExporterAgentInit(kafka *litekafkav1alpha1.KafkaCluster) corev1.Container {
+	return corev1.Container{
+		Name:            "jmx-exporter-agent",
+		Image:           kafka.Spec.Metrics.Image,
+		ImagePullPolicy: "IfNotPresent",
+		Command: []string{
+			"cp",
+			kafka.Spec.Metrics.JarPath,
+			jmxExporterAgentDir + "/jmx_prometheus_javaagent.jar",
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "jmx-exporter-agent",
+				MountPath: jmxExporterAgentDir,
+			},
+		},
+	}
+}
+
+// getJMXExporterVolumes returns volumes of JMX exporter configuration and javaagent
+func getJMXExporterVolumes(kafka *litekafkav1alpha1.KafkaCluster) []corev1.Volume {
+	volumes := []corev1.Volume{
+		{
+			Name: "jmx-exporter-config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: getMetricsConfigMapName(kafka)},
+				},
+			},
+		},
+	}
+	if kafka.Spec.Metrics.Mode == litekafkav1alpha1.MetricsModeJavaAgent {
+		volumes = append(volumes, corev1.Volume{
+			Name: "jmx-exporter-agent",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	return volumes
+}
+
+// addJMXExporter adds JMX exporter to Kafka container of pod, as sidecar or as javaagent
+func addJMXExporter(kafka *litekafkav1alpha1.KafkaCluster, podSpec *corev1.PodSpec) {
+	podSpec.Volumes = append(podSpec.Volumes, getJMXExporterVolumes(kafka)...)
+	if kafka.Spec.Metrics.Mode != litekafkav1alpha1.MetricsModeJavaAgent {
+		podSpec.Containers = append(podSpec.Containers, getJMXExporterSidecar(kafka))
+		return
+	}
+
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, []corev1.VolumeMount{
+		{
+			Name:      "jmx-exporter-config",
+			MountPath: jmxExporterConfigDir,
+		},
+		{
+			Name:      "jmx-exporter-agent",
+			MountPath: jmxExporterAgentDir,
+		},
+	}...)
+	container.Ports = append(container.Ports, corev1.ContainerPort{
+		Name:          kafka.Spec.Metrics.Port.Name,
+		ContainerPort: kafka.Spec.Metrics.Port.Port,
+	})
+	// Start command may extend KAFKA_OPTS further
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name: "KAFKA_OPTS",
+		Value: fmt.Sprintf("-javaagent:%s/jmx_prometheus_javaagent.jar=%d:%s/config.yml",
+			jmxExporterAgentDir, kafka.Spec.Metrics.Port.Port, jmxExporterConfigDir),
+	})
+	podSpec.InitContainers = append(podSpec.InitContainers, getJMXExporterAgentInit(kafka))
+}
+
+func getKafkaMetricsConfigMap(kafka *litekafkav1alpha1.KafkaCluster) *corev1.ConfigMap {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      getMetricsConfigMapName(kafka),
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "kafka-broker",
+			"app.kubernetes.io/name":      "kafka",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+
+	configMap := corev1.ConfigMap{
+		ObjectMeta: metaData,
+		Data: map[string]string{
+			"config.yml": getJMXExporterConfig(kafka),
+		},
+	}
+
+	return &configMap
+}
+
+func getKafkaMetricsService(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Service {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-kafka-metrics",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "kafka-metrics",
+			"app.kubernetes.io/name":      "kafka",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+
+	// Every broker and KRaft controller is scraped, so endpoints of pods are published
+	service := corev1.Service{
+		ObjectMeta: metaData,
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       kafka.Spec.Metrics.Port.Name,
+					Port:       kafka.Spec.Metrics.Port.Port,
+					TargetPort: intstr.FromString(kafka.Spec.Metrics.Port.Name),
+				},
+			},
+			ClusterIP: "None",
+			Selector: map[string]string{
+				"app.kubernetes.io/name":     "kafka",
+				"app.kubernetes.io/instance": kafka.Name,
+			},
+		},
+	}
+
+	return &service
+}
@@ -0,0 +1,282 @@
+package kafkacluster
+
+import (
+	"context"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/Svimba/lite-kafka-operator/pkg/zookeeper"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// migrationRequeueInterval is a period of checking progress of migration
+const migrationRequeueInterval = 10 * time.Second
+
+// reconcileMigration moves cluster running in zookeeper mode to KRaft mode phase by phase,
+// it returns true when brokers are handled by migration
+func (r *ReconcileKafkaCluster) reconcileMigration(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (reconcile.Result, bool, error) {
+	status := kafka.Status.DeepCopy()
+	migrating, err := r.handleMigration(kafka, rlog)
+	if statusErr := r.updateStatus(kafka, status); statusErr != nil {
+		rlog.Error(statusErr, "Cannot update status of KafkaCluster")
+		if err == nil {
+			err = statusErr
+		}
+	}
+	if err != nil {
+		rlog.Error(err, "Migration to KRaft failed", "Phase", kafka.Status.GetMigrationPhase())
+		r.recorder.Eventf(kafka, corev1.EventTypeWarning, "MigrationFailed", "Migration to KRaft failed in phase %s: %v", kafka.Status.GetMigrationPhase(), err)
+		return reconcile.Result{Requeue: true}, migrating, err
+	}
+	if !migrating {
+		return reconcile.Result{}, false, nil
+	}
+	return reconcile.Result{RequeueAfter: migrationRequeueInterval}, true, nil
+}
+
+// handleMigration starts, rolls back or advances migration, it returns true while migration is in progress
+func (r *ReconcileKafkaCluster) handleMigration(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	phase := kafka.Status.GetMigrationPhase()
+	rollback := kafka.Spec.Mode != litekafkav1alpha1.ModeKRaft
+
+	switch {
+	case len(phase) == 0 && rollback:
+		return false, nil
+	case len(phase) == 0:
+		return r.startMigration(kafka, rlog)
+	case rollback && (phase == litekafkav1alpha1.MigrationPhaseControllers || phase == litekafkav1alpha1.MigrationPhaseBrokersMigration):
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseRollingBack)
+	case rollback && phase == litekafkav1alpha1.MigrationPhaseBrokersKRaft:
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseRollingBackBrokers)
+	case rollback && phase == litekafkav1alpha1.MigrationPhaseFinalizing:
+		rlog.Info("Migration to KRaft is being finalized, rollback is not possible")
+		r.recorder.Event(kafka, corev1.EventTypeWarning, "RollbackNotPossible", "Migration to KRaft is being finalized, rollback is not possible")
+	case !rollback && phase == litekafkav1alpha1.MigrationPhaseRollingBackBrokers:
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseBrokersKRaft)
+	}
+
+	switch kafka.Status.GetMigrationPhase() {
+	case litekafkav1alpha1.MigrationPhaseControllers:
+		done, err := r.handleMigrationControllers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseBrokersMigration)
+	case litekafkav1alpha1.MigrationPhaseBrokersMigration:
+		done, err := r.handleMigrationBrokers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		migrated, err := r.isMetadataMigrated(kafka)
+		if err != nil || !migrated {
+			rlog.Info("Waiting for KRaft controllers to migrate metadata from Zookeeper")
+			r.recorder.Event(kafka, corev1.EventTypeNormal, "WaitingForMetadataMigration", "Waiting for KRaft controllers to migrate metadata from Zookeeper")
+			return true, err
+		}
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseBrokersKRaft)
+	case litekafkav1alpha1.MigrationPhaseBrokersKRaft:
+		done, err := r.handleMigrationBrokers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseFinalizing)
+	case litekafkav1alpha1.MigrationPhaseFinalizing:
+		done, err := r.handleMigrationControllers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		rlog.Info("Migration to KRaft completed")
+		r.recorder.Event(kafka, corev1.EventTypeNormal, "MigrationCompleted", "Migration to KRaft completed, cluster runs in KRaft mode")
+		kafka.Status.Mode = litekafkav1alpha1.ModeKRaft
+		kafka.Status.Migration = nil
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionMigrating, corev1.ConditionFalse, "Completed", "Cluster runs in KRaft mode")
+		return false, nil
+	case litekafkav1alpha1.MigrationPhaseRollingBackBrokers:
+		done, err := r.handleMigrationBrokers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseRollingBack)
+	case litekafkav1alpha1.MigrationPhaseRollingBack:
+		done, err := r.handleRollbackControllers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		done, err = r.handleMigrationBrokers(kafka, rlog)
+		if err != nil || !done {
+			return true, err
+		}
+		rlog.Info("Migration to KRaft rolled back")
+		r.recorder.Event(kafka, corev1.EventTypeNormal, "MigrationRolledBack", "Migration to KRaft rolled back, cluster runs in Zookeeper mode")
+		kafka.Status.Migration = nil
+		kafka.Status.KRaft = nil
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionMigrating, corev1.ConditionFalse, "RolledBack", "Cluster runs in Zookeeper mode")
+		return false, nil
+	}
+	return true, nil
+}
+
+// startMigration checks migration can start and takes cluster ID from zookeeper
+func (r *ReconcileKafkaCluster) startMigration(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	if kafka.Spec.KRaft.ControllerReplicas == 0 {
+		rlog.Info("Migration to KRaft requires dedicated controllers")
+		r.recorder.Event(kafka, corev1.EventTypeWarning, "ControllersRequired", "Migration to KRaft requires spec.kraft.controllerReplicas")
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionMigrating, corev1.ConditionFalse, "ControllersRequired",
+			"Migration to KRaft requires spec.kraft.controllerReplicas")
+		return false, nil
+	}
+
+	zkClient, err := r.newZookeeperClient(kafka)
+	if err != nil {
+		return true, err
+	}
+	defer zkClient.Close()
+	// Controllers have to join cluster registered in zookeeper
+	clusterID, err := zkClient.GetClusterID(kafka.Spec.Zookeeper.Chroot)
+	if err != nil {
+		return true, err
+	}
+
+	rlog.Info("Starting migration to KRaft", "ClusterID", clusterID)
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "MigrationStarted", "Starting migration to KRaft of cluster %s", clusterID)
+	kafka.Status.ClusterID = clusterID
+	kafka.Status.KRaft = newKRaftStatus(kafka)
+	r.setMigrationPhase(kafka, rlog, litekafkav1alpha1.MigrationPhaseControllers)
+	return true, nil
+}
+
+// setMigrationPhase records phase of migration in status
+func (r *ReconcileKafkaCluster) setMigrationPhase(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, phase litekafkav1alpha1.MigrationPhase) {
+	rlog.Info("Migration to KRaft moves to next phase", "Phase", phase)
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "MigrationPhase", "Migration between Zookeeper and KRaft moves to phase %s", phase)
+	kafka.Status.SetMigrationPhase(phase)
+	kafka.Status.SetCondition(litekafkav1alpha1.ConditionMigrating, corev1.ConditionTrue, string(phase), "Migration between Zookeeper and KRaft is in progress")
+}
+
+// handleMigrationControllers deploys controllers in configuration of current phase and rolls them
+func (r *ReconcileKafkaCluster) handleMigrationControllers(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	if err := r.handleService(kafka, rlog, getKafkaControllerServiceHeadless(kafka)); err != nil {
+		return false, err
+	}
+	sts := getKafkaControllerStatefulSet(kafka)
+	if _, err := r.handleStatefulSet(kafka, rlog, sts); err != nil {
+		return false, err
+	}
+	return r.rollStatefulSet(kafka, rlog, sts.Name)
+}
+
+// handleMigrationBrokers updates brokers to configuration of current phase and rolls them
+func (r *ReconcileKafkaCluster) handleMigrationBrokers(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	sts := getKafkaStatefulSet(kafka, r.options.ProbeImage)
+	if _, err := r.handleStatefulSet(kafka, rlog, sts); err != nil {
+		return false, err
+	}
+	requeue, err := r.handlePodsRack(kafka, rlog)
+	if err != nil || requeue {
+		return false, err
+	}
+	return r.rollStatefulSet(kafka, rlog, sts.Name)
+}
+
+// handleRollbackControllers removes KRaft controllers with their data and releases controller and migration znodes,
+// so brokers in zookeeper mode elect controller among themselves
+func (r *ReconcileKafkaCluster) handleRollbackControllers(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	sts := getKafkaControllerStatefulSet(kafka)
+	found := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if err == nil {
+		rlog.Info("Deleting KRaft controllers", "Namespace", found.Namespace, "Name", found.Name)
+		if err = r.deleteResource(kafka, found, "StatefulSet", found.Name); err != nil {
+			return false, err
+		}
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	pods := &corev1.PodList{}
+	err = r.client.List(context.TODO(), client.InNamespace(sts.Namespace).MatchingLabels(sts.Spec.Selector.MatchLabels), pods)
+	if err != nil {
+		return false, err
+	}
+	if len(pods.Items) > 0 {
+		rlog.Info("Waiting for KRaft controllers to terminate", "Pods", len(pods.Items))
+		r.recorder.Eventf(kafka, corev1.EventTypeNormal, "WaitingForPods", "Waiting for %d KRaft controllers to terminate", len(pods.Items))
+		return false, nil
+	}
+
+	// Metadata of controllers are not valid anymore, next migration starts from zookeeper again
+	claims := &corev1.PersistentVolumeClaimList{}
+	err = r.client.List(context.TODO(), client.InNamespace(sts.Namespace).MatchingLabels(sts.Spec.Selector.MatchLabels), claims)
+	if err != nil {
+		return false, err
+	}
+	for i := range claims.Items {
+		rlog.Info("Deleting PersistentVolumeClaim of KRaft controller", "Namespace", claims.Items[i].Namespace, "Name", claims.Items[i].Name)
+		if err = r.deleteResource(kafka, &claims.Items[i], "PersistentVolumeClaim", claims.Items[i].Name); err != nil {
+			return false, err
+		}
+	}
+	service := &corev1.Service{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: kafka.Name + "-controller-headless", Namespace: kafka.Namespace}, service)
+	if err == nil {
+		if err = r.deleteResource(kafka, service, "Service", service.Name); err != nil {
+			return false, err
+		}
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	zkClient, err := r.newZookeeperClient(kafka)
+	if err != nil {
+		return false, err
+	}
+	defer zkClient.Close()
+	controllerID, err := zkClient.GetControllerID(kafka.Spec.Zookeeper.Chroot)
+	if err != nil {
+		return false, err
+	}
+	if controllerID >= kraftControllerIDOffset {
+		rlog.Info("Deleting controller znode of KRaft controller", "ControllerID", controllerID)
+		if err = zkClient.DeleteController(kafka.Spec.Zookeeper.Chroot); err != nil {
+			return false, err
+		}
+	}
+	// Migration state keeps offset of metadata copied by removed controllers, retried migration
+	// would take metadata for migrated before new controllers copy them
+	rlog.Info("Deleting migration state of KRaft controllers")
+	if err = zkClient.DeleteMigrationState(kafka.Spec.Zookeeper.Chroot); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isMetadataMigrated returns true when controllers finished copying of metadata from zookeeper
+func (r *ReconcileKafkaCluster) isMetadataMigrated(kafka *litekafkav1alpha1.KafkaCluster) (bool, error) {
+	zkClient, err := r.newZookeeperClient(kafka)
+	if err != nil {
+		return false, err
+	}
+	defer zkClient.Close()
+	state, err := zkClient.GetMigrationState(kafka.Spec.Zookeeper.Chroot)
+	if err != nil {
+		return false, err
+	}
+	return state.Migrated(), nil
+}
+
+// newZookeeperClient connects to zookeeper of cluster
+func (r *ReconcileKafkaCluster) newZookeeperClient(kafka *litekafkav1alpha1.KafkaCluster) (*zookeeper.Client, error) {
+	zkOptions, err := r.getZookeeperConnectionOptions(kafka)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 15*time.Second)
+	defer cancel()
+	return r.zookeeperFactory(ctx, kafka.Spec.Zookeeper.GetServers(), zkOptions)
+}
@@ -0,0 +1,120 @@
+package kafkacluster
+
+import (
+	"fmt"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	monitoringv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// getMonitoringLabels returns labels of ServiceMonitor and PrometheusRule, Prometheus selects them by monitorLabels
+func getMonitoringLabels(kafka *litekafkav1alpha1.KafkaCluster) map[string]string {
+	labels := map[string]string{}
+	for key, value := range kafka.Spec.Metrics.MonitorLabels {
+		labels[key] = value
+	}
+	labels["app.kubernetes.io/component"] = "kafka-metrics"
+	labels["app.kubernetes.io/name"] = "kafka"
+	labels["app.kubernetes.io/instance"] = kafka.Name
+	return labels
+}
+
+func getKafkaServiceMonitor(kafka *litekafkav1alpha1.KafkaCluster) *monitoringv1.ServiceMonitor {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-kafka",
+		Labels:    getMonitoringLabels(kafka),
+	}
+
+	serviceMonitor := monitoringv1.ServiceMonitor{
+		ObjectMeta: metaData,
+		Spec: monitoringv1.ServiceMonitorSpec{
+			Endpoints: []monitoringv1.Endpoint{
+				{
+					Port:     kafka.Spec.Metrics.Port.Name,
+					Interval: "30s",
+				},
+			},
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/component": "kafka-metrics",
+					"app.kubernetes.io/name":      "kafka",
+					"app.kubernetes.io/instance":  kafka.Name,
+				},
+			},
+			NamespaceSelector: monitoringv1.NamespaceSelector{
+				MatchNames: []string{kafka.Namespace},
+			},
+		},
+	}
+
+	return &serviceMonitor
+}
+
+func getKafkaPrometheusRule(kafka *litekafkav1alpha1.KafkaCluster) *monitoringv1.PrometheusRule {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-kafka",
+		Labels:    getMonitoringLabels(kafka),
+	}
+	// Series of brokers and controllers are selected by metrics Service, volumes by their PersistentVolumeClaims
+	brokers := fmt.Sprintf(`namespace="%s",service="%s-kafka-metrics"`, kafka.Namespace, kafka.Name)
+	volumes := fmt.Sprintf(`namespace="%s",persistentvolumeclaim=~"datadir-%s-(kafka|controller)-[0-9]+"`, kafka.Namespace, kafka.Name)
+	critical := map[string]string{"severity": "critical", "kafka_cluster": kafka.Name}
+	warning := map[string]string{"severity": "warning", "kafka_cluster": kafka.Name}
+
+	rule := monitoringv1.PrometheusRule{
+		ObjectMeta: metaData,
+		Spec: monitoringv1.PrometheusRuleSpec{
+			Groups: []monitoringv1.RuleGroup{
+				{
+					Name: "kafka",
+					Rules: []monitoringv1.Rule{
+						{
+							Alert:  "KafkaOfflinePartitions",
+							Expr:   intstr.FromString(fmt.Sprintf(`sum(kafka_controller_kafkacontroller_offlinepartitionscount{%s}) > 0`, brokers)),
+							For:    "1m",
+							Labels: critical,
+							Annotations: map[string]string{
+								"message": fmt.Sprintf("Kafka cluster %s/%s has {{ $value }} offline partitions.", kafka.Namespace, kafka.Name),
+							},
+						},
+						{
+							Alert:  "KafkaUnderReplicatedPartitions",
+							Expr:   intstr.FromString(fmt.Sprintf(`sum(kafka_server_replicamanager_underreplicatedpartitions{%s}) > 0`, brokers)),
+							For:    "10m",
+							Labels: warning,
+							Annotations: map[string]string{
+								"message": fmt.Sprintf("Kafka cluster %s/%s has {{ $value }} under-replicated partitions.", kafka.Namespace, kafka.Name),
+							},
+						},
+						{
+							Alert:  "KafkaNoActiveController",
+							Expr:   intstr.FromString(fmt.Sprintf(`sum(kafka_controller_kafkacontroller_activecontrollercount{%s}) < 1`, brokers)),
+							For:    "5m",
+							Labels: critical,
+							Annotations: map[string]string{
+								"message": fmt.Sprintf("Kafka cluster %s/%s has no active controller.", kafka.Namespace, kafka.Name),
+							},
+						},
+						{
+							Alert: "KafkaDiskUsageHigh",
+							Expr: intstr.FromString(fmt.Sprintf(`kubelet_volume_stats_used_bytes{%s} / kubelet_volume_stats_capacity_bytes{%s} * 100 > 85`,
+								volumes, volumes)),
+							For:    "10m",
+							Labels: warning,
+							Annotations: map[string]string{
+								"message": fmt.Sprintf("Volume {{ $labels.persistentvolumeclaim }} of Kafka cluster %s/%s is {{ $value | humanize }}%% full.",
+									kafka.Namespace, kafka.Name),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return &rule
+}
@@ -0,0 +1,155 @@
+package kafkacluster
+
+import (
+	"context"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Phases of reconcile, each phase is measured separately
+const (
+	phaseServices   = "services"
+	phaseBrokerIDs  = "broker_ids"
+	phaseMetrics    = "metrics"
+	phaseMonitoring = "monitoring"
+	phaseKRaft      = "kraft"
+	phaseZookeeper  = "zookeeper"
+	phaseMigration  = "migration"
+	phaseBrokers    = "brokers"
+	phaseRack       = "rack"
+	phaseHealth     = "health"
+)
+
+// Operations which take more reconciles to complete
+const (
+	operationRollingRestart = "rolling_restart"
+	operationScale          = "scale"
+	operationMigration      = "migration"
+)
+
+var (
+	reconcilePhases = []string{phaseServices, phaseBrokerIDs, phaseMetrics, phaseMonitoring, phaseKRaft, phaseZookeeper,
+		phaseMigration, phaseBrokers, phaseRack, phaseHealth}
+	operations = []string{operationRollingRestart, operationScale, operationMigration}
+
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "litekafka_reconcile_total",
+		Help: "Total number of reconciles of KafkaCluster per phase and result",
+	}, []string{"namespace", "name", "phase", "result"})
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "litekafka_reconcile_errors_total",
+		Help: "Total number of failed reconciles of KafkaCluster per phase",
+	}, []string{"namespace", "name", "phase"})
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "litekafka_reconcile_duration_seconds",
+		Help:    "Duration of reconcile phases of KafkaCluster",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"namespace", "name", "phase"})
+	zookeeperCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "litekafka_zookeeper_check_duration_seconds",
+		Help:    "Duration of readiness check of Zookeeper ensemble of KafkaCluster",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"namespace", "name"})
+	zookeeperReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "litekafka_zookeeper_ready",
+		Help: "Result of last readiness check of Zookeeper ensemble of KafkaCluster, 1 when ready",
+	}, []string{"namespace", "name"})
+	brokersDesired = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "litekafka_brokers_desired",
+		Help: "Number of brokers in spec of KafkaCluster",
+	}, []string{"namespace", "name"})
+	brokersReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "litekafka_brokers_ready",
+		Help: "Number of ready broker pods of KafkaCluster",
+	}, []string{"namespace", "name"})
+	operationInProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "litekafka_operation_in_progress",
+		Help: "Operations in progress on KafkaCluster, 1 while operation runs",
+	}, []string{"namespace", "name", "operation"})
+)
+
+func init() {
+	// Registry of controller-runtime is served by manager on metrics port
+	metrics.Registry.MustRegister(reconcileTotal, reconcileErrors, reconcileDuration, zookeeperCheckDuration,
+		zookeeperReady, brokersDesired, brokersReady, operationInProgress)
+}
+
+// reconcileMetrics measures phases of one reconcile of cluster
+type reconcileMetrics struct {
+	namespace string
+	name      string
+	start     time.Time
+}
+
+func newReconcileMetrics(kafka *litekafkav1alpha1.KafkaCluster) *reconcileMetrics {
+	return &reconcileMetrics{namespace: kafka.Namespace, name: kafka.Name, start: time.Now()}
+}
+
+// observe records result of phase and its duration since previous phase
+func (m *reconcileMetrics) observe(phase string, err error) {
+	now := time.Now()
+	reconcileDuration.WithLabelValues(m.namespace, m.name, phase).Observe(now.Sub(m.start).Seconds())
+	m.start = now
+
+	result := "success"
+	if err != nil {
+		result = "error"
+		reconcileErrors.WithLabelValues(m.namespace, m.name, phase).Inc()
+	}
+	reconcileTotal.WithLabelValues(m.namespace, m.name, phase, result).Inc()
+}
+
+// observeZookeeperCheck records duration and result of zookeeper readiness check
+func observeZookeeperCheck(kafka *litekafkav1alpha1.KafkaCluster, start time.Time, ready bool) {
+	zookeeperCheckDuration.WithLabelValues(kafka.Namespace, kafka.Name).Observe(time.Since(start).Seconds())
+	zookeeperReady.WithLabelValues(kafka.Namespace, kafka.Name).Set(boolToFloat64(ready))
+}
+
+// observeClusterState records desired and ready brokers and operations in progress on cluster
+func (r *ReconcileKafkaCluster) observeClusterState(kafka *litekafkav1alpha1.KafkaCluster) {
+	brokersDesired.WithLabelValues(kafka.Namespace, kafka.Name).Set(float64(kafka.Spec.Replicas))
+	operationInProgress.WithLabelValues(kafka.Namespace, kafka.Name, operationMigration).Set(boolToFloat64(kafka.Status.Migration != nil))
+
+	sts := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: kafka.Name + "-kafka", Namespace: kafka.Namespace}, sts)
+	if err != nil {
+		// Brokers are not deployed yet
+		brokersReady.WithLabelValues(kafka.Namespace, kafka.Name).Set(0)
+		return
+	}
+	brokersReady.WithLabelValues(kafka.Namespace, kafka.Name).Set(float64(sts.Status.ReadyReplicas))
+	// Current revision is not advanced with OnDelete strategy, pods are rolled until all are in update revision
+	rolling := sts.Status.UpdatedReplicas < sts.Status.Replicas
+	operationInProgress.WithLabelValues(kafka.Namespace, kafka.Name, operationRollingRestart).Set(boolToFloat64(rolling))
+	scaling := sts.Spec.Replicas != nil && sts.Status.Replicas != *sts.Spec.Replicas
+	operationInProgress.WithLabelValues(kafka.Namespace, kafka.Name, operationScale).Set(boolToFloat64(scaling))
+}
+
+// deleteClusterMetrics removes all metrics of deleted cluster
+func deleteClusterMetrics(namespace, name string) {
+	for _, phase := range reconcilePhases {
+		reconcileTotal.DeleteLabelValues(namespace, name, phase, "success")
+		reconcileTotal.DeleteLabelValues(namespace, name, phase, "error")
+		reconcileErrors.DeleteLabelValues(namespace, name, phase)
+		reconcileDuration.DeleteLabelValues(namespace, name, phase)
+	}
+	for _, operation := range operations {
+		operationInProgress.DeleteLabelValues(namespace, name, operation)
+	}
+	zookeeperCheckDuration.DeleteLabelValues(namespace, name)
+	zookeeperReady.DeleteLabelValues(namespace, name)
+	brokersDesired.DeleteLabelValues(namespace, name)
+	brokersReady.DeleteLabelValues(namespace, name)
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package kafkacluster
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Options configures KafkaCluster controller
+type Options struct {
+	// ZookeeperBackoffBase is the first delay of reconcile waiting for zookeeper
+	ZookeeperBackoffBase time.Duration
+	// ZookeeperBackoffMax limits delay of reconcile waiting for zookeeper
+	ZookeeperBackoffMax time.Duration
+	// ProbeImage is an image with kafka-probe binary used by probes of brokers, TCP probes are used when it is empty
+	ProbeImage string
+	// HealthCheckInterval is a period of collecting cluster state from brokers, health check is disabled when it is 0
+	HealthCheckInterval time.Duration
+	// MaxConcurrentReconciles is a number of clusters reconciled in parallel
+	MaxConcurrentReconciles int
+}
+
+var options = Options{
+	ZookeeperBackoffBase:    5 * time.Second,
+	ZookeeperBackoffMax:     5 * time.Minute,
+	ProbeImage:              os.Getenv("OPERATOR_IMAGE"),
+	HealthCheckInterval:     30 * time.Second,
+	MaxConcurrentReconciles: 1,
+}
+
+// FlagSet returns flags of KafkaCluster controller, it has to be added to command line before parsing
+func FlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("kafkacluster", pflag.ExitOnError)
+	flagSet.DurationVar(&options.ZookeeperBackoffBase, "zookeeper-backoff-base", options.ZookeeperBackoffBase,
+		"First delay of reconcile while Zookeeper is not ready, it doubles up to zookeeper-backoff-max")
+	flagSet.DurationVar(&options.ZookeeperBackoffMax, "zookeeper-backoff-max", options.ZookeeperBackoffMax,
+		"Maximal delay of reconcile while Zookeeper is not ready")
+	flagSet.StringVar(&options.ProbeImage, "probe-image", options.ProbeImage,
+		"Image with kafka-probe binary used by probes of brokers, defaults to OPERATOR_IMAGE environment variable")
+	flagSet.DurationVar(&options.HealthCheckInterval, "health-check-interval", options.HealthCheckInterval,
+		"Period of collecting cluster state from brokers into status of KafkaCluster, 0 disables health check")
+	flagSet.IntVar(&options.MaxConcurrentReconciles, "max-concurrent-reconciles", options.MaxConcurrentReconciles,
+		"Number of KafkaClusters reconciled in parallel, slow cluster does not block others when it is higher than 1")
+	return flagSet
+}
@@ -0,0 +1,70 @@
+package kafkacluster
+
+import (
+	"fmt"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcilePaused updates status of paused cluster without changing any of its resources
+func (r *ReconcileKafkaCluster) reconcilePaused(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) reconcile.Result {
+	rlog.Info("Skip reconcile: KafkaCluster is paused")
+	status := kafka.Status.DeepCopy()
+	message := "Reconcile is paused by spec.paused"
+	if !kafka.Spec.Paused {
+		message = fmt.Sprintf("Reconcile is paused by annotation %s", litekafkav1alpha1.PausedAnnotation)
+	}
+	if kafka.DeletionTimestamp != nil && containsString(kafka.Finalizers, teardownFinalizer) {
+		message += ", teardown of deleted cluster waits until reconcile is resumed"
+	}
+	kafka.Status.SetCondition(litekafkav1alpha1.ConditionPaused, corev1.ConditionTrue, "Paused", message)
+	if condition := status.GetCondition(litekafkav1alpha1.ConditionPaused); condition == nil ||
+		condition.Status != corev1.ConditionTrue || condition.Message != message {
+		r.recorder.Event(kafka, corev1.EventTypeNormal, "Paused", message)
+	}
+
+	if kafka.Status.Mode != litekafkav1alpha1.ModeKRaft && *kafka.Spec.ZookeeperCheck {
+		zkOptions, err := r.getZookeeperConnectionOptions(kafka)
+		if err != nil {
+			rlog.Error(err, "Cannot get Zookeeper connection options")
+		} else {
+			r.checkZookeeper(kafka, zkOptions)
+		}
+	}
+
+	// Health is collected from brokers only, it is safe to check it while paused
+	result := reconcile.Result{}
+	if r.options.HealthCheckInterval > 0 {
+		r.checkHealth(kafka, status, rlog)
+		result.RequeueAfter = r.options.HealthCheckInterval
+	}
+
+	// Restarted brokers wait for rack annotation, it is set also while paused, so they can start
+	requeue, err := r.handlePodsRack(kafka, rlog)
+	if err != nil {
+		rlog.Error(err, "Cannot set rack of brokers")
+	}
+	if (err != nil || requeue) && (result.RequeueAfter == 0 || result.RequeueAfter > 5*time.Second) {
+		result.RequeueAfter = 5 * time.Second
+	}
+	if err := r.updateStatus(kafka, status); err != nil {
+		rlog.Error(err, "Cannot update status of KafkaCluster")
+	}
+	return result
+}
+
+// resumeReconcile sets condition of previously paused cluster, it returns true when cluster is resumed
+// and caller writes the condition with the rest of status
+func (r *ReconcileKafkaCluster) resumeReconcile(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) bool {
+	if !kafka.Status.IsConditionTrue(litekafkav1alpha1.ConditionPaused) {
+		return false
+	}
+	rlog.Info("Reconcile of KafkaCluster is resumed")
+	kafka.Status.SetCondition(litekafkav1alpha1.ConditionPaused, corev1.ConditionFalse, "Resumed", "Reconcile is resumed")
+	r.recorder.Event(kafka, corev1.EventTypeNormal, "Resumed", "Reconcile is resumed, changes of spec are applied")
+	return true
+}
@@ -1,18 +1,69 @@
 package kafkacluster
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 
 	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	resource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-func getKafkaStatefulSet(kafka *litekafkav1alpha1.KafkaCluster) *appsv1.StatefulSet {
+const (
+	templateHashAnnotation = "litekafka.operator.mirantis.com/template-hash"
+	rackAnnotation         = "litekafka.operator.mirantis.com/rack"
+	// rackAnnotationTimeoutSeconds limits wait of broker for rack annotation, broker fails and is restarted after it
+	rackAnnotationTimeoutSeconds = 300
+	// brokerIDsPath is a directory of broker IDs ConfigMap in broker pods
+	brokerIDsPath = "/opt/kafka/broker-ids"
+)
+
+// getPodTemplateHash returns hash of pod template, used to detect changes of StatefulSet template
+func getPodTemplateHash(template *corev1.PodTemplateSpec) string {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// getKafkaAffinity returns affinity from pod template or default preferred anti-affinity of brokers across nodes,
+// instance label alone would match also Zookeeper and KRaft controller pods of the cluster
+func getKafkaAffinity(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Affinity {
+	if kafka.Spec.Template != nil && kafka.Spec.Template.Pod != nil && kafka.Spec.Template.Pod.Affinity != nil {
+		return kafka.Spec.Template.Pod.Affinity
+	}
+	return &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"app.kubernetes.io/component": "kafka-broker",
+								"app.kubernetes.io/name":      "kafka",
+								"app.kubernetes.io/instance":  kafka.Name,
+							},
+						},
+						TopologyKey: "kubernetes.io/hostname",
+					},
+				},
+			},
+		},
+	}
+}
+
+// getKafkaStatefulSet returns StatefulSet of brokers, probeImage provides kafka-probe binary used by probes
+func getKafkaStatefulSet(kafka *litekafkav1alpha1.KafkaCluster, probeImage string) *appsv1.StatefulSet {
 	metaData := metav1.ObjectMeta{
 		Namespace: kafka.Namespace,
 		Name:      kafka.Name + "-kafka",
@@ -30,15 +81,11 @@ func getKafkaStatefulSet(kafka *litekafkav1alpha1.KafkaCluster) *appsv1.Stateful
 		},
 	}
 	replicas := kafka.Spec.Replicas
-	terminationGracePeriodSeconds := int64(60)
+	// jps is not part of every Kafka image, so broker is alive while it listens without kafka-probe
 	livenessProbe := &corev1.Probe{
 		Handler: corev1.Handler{
-			Exec: &corev1.ExecAction{
-				Command: []string{
-					"sh",
-					"-ec",
-					"/usr/bin/jps | /bin/grep -q SupportedKafka",
-				},
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.IntOrString{StrVal: kafka.Spec.ContainerPort.Name, IntVal: kafka.Spec.ContainerPort.Port},
 			},
 		},
 		InitialDelaySeconds: 30,
@@ -104,10 +151,6 @@ func getKafkaStatefulSet(kafka *litekafkav1alpha1.KafkaCluster) *appsv1.Stateful
 			Name:  "KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR",
 			Value: strconv.FormatUint(uint64(kafka.Spec.Options.TopicReplicationFactor), 10),
 		},
-		{
-			Name:  "KAFKA_ZOOKEEPER_CONNECT",
-			Value: fmt.Sprintf("%s:%d", kafka.Spec.Zookeeper.Host, kafka.Spec.Zookeeper.Port.Port),
-		},
 		{
 			Name:  "KAFKA_LOG_DIRS",
 			Value: "/opt/kafka/data/logs",
@@ -116,61 +159,415 @@ func getKafkaStatefulSet(kafka *litekafkav1alpha1.KafkaCluster) *appsv1.Stateful
 			Name:  "KAFKA_CONFLUENT_SUPPORT_METRICS_ENABLE",
 			Value: "false",
 		},
+		{
+			// Broker moves leadership of its partitions away before it stops, it is verified by health check
+			Name:  "KAFKA_CONTROLLED_SHUTDOWN_ENABLE",
+			Value: "true",
+		},
 		{
 			Name:  "KAFKA_JMX_PORT",
 			Value: strconv.FormatUint(uint64(kafka.Spec.Options.JXMPort), 10),
 		},
 	}
 
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "datadir",
+			MountPath: "/opt/kafka/data",
+		},
+	}
+	volumes := []corev1.Volume{}
+	ports := []corev1.ContainerPort{
+		{
+			Name:          kafka.Spec.ContainerPort.Name,
+			ContainerPort: kafka.Spec.ContainerPort.Port,
+		},
+		{
+			Name:          "jmx",
+			ContainerPort: int32(kafka.Spec.Options.JXMPort),
+		},
+	}
+	podManagementPolicy := appsv1.OrderedReadyPodManagement
+	brokerID := `${POD_NAME##*-}`
+	if hasBrokerIDs(kafka) {
+		// Broker ID is read from map maintained by operator, offset is used until pod is in the map
+		brokerID = fmt.Sprintf(`$(cat %s/${POD_NAME} 2>/dev/null || echo $((%d + ${POD_NAME##*-})))`, brokerIDsPath, kafka.Spec.BrokerIDOffset)
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "broker-ids",
+			MountPath: brokerIDsPath,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: "broker-ids",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: getKafkaBrokerIDsConfigMapName(kafka)},
+				},
+			},
+		})
+	}
+	startCmd := `unset KAFKA_PORT && export KAFKA_BROKER_ID=` + brokerID + ` && export KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://${POD_IP}:` + fmt.Sprintf("%d", kafka.Spec.ContainerPort.Port)
+	brokerMode := getBrokerMode(kafka)
+	if brokerMode == litekafkav1alpha1.ModeKRaft {
+		envVars = append(envVars, getKRaftEnv(kafka)...)
+		startCmd = `unset KAFKA_PORT && export KAFKA_NODE_ID=` + brokerID + ` && export KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://${POD_IP}:` + fmt.Sprintf("%d", kafka.Spec.ContainerPort.Port)
+		listeners := fmt.Sprintf("PLAINTEXT://0.0.0.0:%d", kafka.Spec.ContainerPort.Port)
+		if kafka.Spec.KRaft.ControllerReplicas == 0 {
+			// First brokers are also controllers, their number is recorded in status when quorum is formed,
+			// so scaling of brokers does not change voters
+			ports = append(ports, corev1.ContainerPort{
+				Name:          kafka.Spec.KRaft.ControllerPort.Name,
+				ContainerPort: kafka.Spec.KRaft.ControllerPort.Port,
+			})
+			startCmd += fmt.Sprintf(` && if [ ${KAFKA_NODE_ID} -lt %d ]; then export KAFKA_PROCESS_ROLES=broker,controller KAFKA_LISTENERS=%s,CONTROLLER://0.0.0.0:%d; else export KAFKA_PROCESS_ROLES=broker KAFKA_LISTENERS=%s; fi`,
+				getKRaftVotersCount(kafka), listeners, kafka.Spec.KRaft.ControllerPort.Port, listeners)
+		} else {
+			startCmd += ` && export KAFKA_PROCESS_ROLES=broker KAFKA_LISTENERS=` + listeners
+		}
+		// KRaft voters have to resolve each other before they are ready
+		podManagementPolicy = appsv1.ParallelPodManagement
+	} else {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "KAFKA_ZOOKEEPER_CONNECT",
+			Value: kafka.Spec.Zookeeper.GetConnectString(),
+		})
+	}
+	if kafka.Spec.Rack != nil {
+		// Rack annotation is set by operator from node labels and exposed to broker by downward API
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "podinfo",
+			MountPath: "/etc/podinfo",
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: "podinfo",
+			VolumeSource: corev1.VolumeSource{
+				DownwardAPI: &corev1.DownwardAPIVolumeSource{
+					Items: []corev1.DownwardAPIVolumeFile{
+						{
+							Path: "annotations",
+							FieldRef: &corev1.ObjectFieldSelector{
+								FieldPath: "metadata.annotations",
+							},
+						},
+					},
+				},
+			},
+		})
+		startCmd += ` && WAIT=0 && until grep -q '^` + rackAnnotation + `=' /etc/podinfo/annotations; do` +
+			fmt.Sprintf(` if [ ${WAIT} -ge %d ]; then echo "Rack annotation %s was not set in %ds" >&2; exit 1; fi;`,
+				rackAnnotationTimeoutSeconds, rackAnnotation, rackAnnotationTimeoutSeconds) +
+			` WAIT=$((WAIT + 1)); sleep 1; done` +
+			` && RACK=$(sed -n 's|^` + rackAnnotation + `="\(.*\)"$|\1|p' /etc/podinfo/annotations)` +
+			` && if [ -n "${RACK}" ]; then export KAFKA_BROKER_RACK=${RACK}; fi`
+	}
+	if brokerMode != litekafkav1alpha1.ModeKRaft {
+		zkEnvVars, zkVolumes, zkVolumeMounts, zkCmd := getZookeeperSecurityConfig(kafka)
+		envVars = append(envVars, zkEnvVars...)
+		volumes = append(volumes, zkVolumes...)
+		volumeMounts = append(volumeMounts, zkVolumeMounts...)
+		startCmd += zkCmd
+	}
+	if brokerMode == brokerModeMigration {
+		// Broker keeps broker.id and zookeeper, and registers to KRaft controllers
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "KAFKA_ZOOKEEPER_METADATA_MIGRATION_ENABLE",
+			Value: "true",
+		})
+		envVars = append(envVars, getKRaftEnv(kafka)...)
+	}
+	startCmd += ` && exec /etc/confluent/docker/run`
+
+	podSpec := corev1.PodSpec{
+		TerminationGracePeriodSeconds: kafka.Spec.TerminationGracePeriodSeconds,
+		Affinity:                      getKafkaAffinity(kafka),
+		Containers: []corev1.Container{
+			{
+				Name:            "kafka-broker",
+				Image:           kafka.Spec.Image,
+				ImagePullPolicy: "IfNotPresent",
+				LivenessProbe:   livenessProbe,
+				ReadinessProbe:  readinessProbe,
+				Ports:           ports,
+				Env:             envVars,
+				Command: []string{
+					`sh`,
+					`-exc`,
+					startCmd,
+				},
+				VolumeMounts: volumeMounts,
+			},
+		},
+		Volumes: volumes,
+	}
+	if len(probeImage) > 0 {
+		addKafkaProbe(kafka, probeImage, &podSpec)
+	}
+	if kafka.Spec.Metrics != nil {
+		addJMXExporter(kafka, &podSpec)
+	}
+	if kafka.Spec.Template != nil && kafka.Spec.Template.Pod != nil {
+		podSpec.NodeSelector = kafka.Spec.Template.Pod.NodeSelector
+		podSpec.Tolerations = kafka.Spec.Template.Pod.Tolerations
+		podSpec.PriorityClassName = kafka.Spec.Template.Pod.PriorityClassName
+	}
+
 	sts := appsv1.StatefulSet{
 		ObjectMeta: metaData,
 		Spec: appsv1.StatefulSetSpec{
 			Replicas:            &replicas,
 			Selector:            selectors,
-			PodManagementPolicy: "OrderedReady",
-			ServiceName:         kafka.Name + "-headless",
+			PodManagementPolicy: podManagementPolicy,
+			ServiceName:         kafka.Name + "-kafka-headless",
 			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
 				Type: "OnDelete",
 			},
 			VolumeClaimTemplates: volumeClaimTemplate,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metaData,
-				Spec: corev1.PodSpec{
-					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
-					Containers: []corev1.Container{
-						{
-							Name:            "kafka-broker",
-							Image:           kafka.Spec.Image,
-							ImagePullPolicy: "IfNotPresent",
-							LivenessProbe:   livenessProbe,
-							ReadinessProbe:  readinessProbe,
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          kafka.Spec.ContainerPort.Name,
-									ContainerPort: kafka.Spec.ContainerPort.Port,
-								},
-							},
-							Env: envVars,
-							Command: []string{
-								`sh`,
-								`-exc`,
-								`unset KAFKA_PORT && export KAFKA_BROKER_ID=${POD_NAME##*-} && export KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://${POD_IP}:` + fmt.Sprintf("%d", kafka.Spec.ContainerPort.Port) + ` && exec /etc/confluent/docker/run`,
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "datadir",
-									MountPath: "/opt/kafka/data",
-								},
-							},
-						},
-					},
-				},
+				Spec:       podSpec,
 			},
 		},
 	}
+	sts.Annotations = map[string]string{
+		templateHashAnnotation: getPodTemplateHash(&sts.Spec.Template),
+	}
 	return &sts
 }
 
+// hasBrokerIDs returns true when IDs of brokers are taken from map maintained by operator, brokers which are
+// also KRaft controllers use ordinals, as quorum voters are given by them
+func hasBrokerIDs(kafka *litekafkav1alpha1.KafkaCluster) bool {
+	return getBrokerMode(kafka) != litekafkav1alpha1.ModeKRaft || kafka.Spec.KRaft.ControllerReplicas > 0
+}
+
+func getKafkaBrokerIDsConfigMapName(kafka *litekafkav1alpha1.KafkaCluster) string {
+	return kafka.Name + "-kafka-broker-ids"
+}
+
+// getKafkaBrokerIDsConfigMap returns map of broker pod names to broker IDs
+func getKafkaBrokerIDsConfigMap(kafka *litekafkav1alpha1.KafkaCluster, brokerIDs map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: kafka.Namespace,
+			Name:      getKafkaBrokerIDsConfigMapName(kafka),
+			Labels: map[string]string{
+				"app.kubernetes.io/component": "kafka-broker",
+				"app.kubernetes.io/name":      "kafka",
+				"app.kubernetes.io/instance":  kafka.Name,
+			},
+		},
+		Data: brokerIDs,
+	}
+}
+
+// getBrokerIDs adds IDs of broker pods which are not in brokerIDs yet, new broker gets offset + ordinal
+// unless the ID belongs to another pod, then it gets next free ID, IDs of existing pods are never changed.
+// IDs of scaled down pods are kept as their volumes with meta.properties are, broker.id of log dirs
+// has to match when pod is scaled up again
+func getBrokerIDs(kafka *litekafkav1alpha1.KafkaCluster, brokerIDs map[string]string) map[string]string {
+	result := map[string]string{}
+	used := map[string]bool{}
+	for name, id := range brokerIDs {
+		result[name] = id
+		used[id] = true
+	}
+	for i := int32(0); i < kafka.Spec.Replicas; i++ {
+		name := fmt.Sprintf("%s-kafka-%d", kafka.Name, i)
+		if _, ok := result[name]; ok {
+			continue
+		}
+		id := kafka.Spec.BrokerIDOffset + i
+		for used[strconv.Itoa(int(id))] {
+			id++
+		}
+		result[name] = strconv.Itoa(int(id))
+		used[result[name]] = true
+	}
+	return result
+}
+
+// addKafkaProbe replaces probes of broker by kafka-probe copied from probeImage by init container,
+// broker is ready when it is registered in cluster and in sync, and it is alive while Kafka process runs,
+// before broker is stopped, kafka-probe starts controlled shutdown and waits until leadership moves away
+func addKafkaProbe(kafka *litekafkav1alpha1.KafkaCluster, probeImage string, podSpec *corev1.PodSpec) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "kafka-probe",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+		Name:            "kafka-probe",
+		Image:           probeImage,
+		ImagePullPolicy: "IfNotPresent",
+		Command: []string{
+			"cp",
+			"/usr/local/bin/kafka-probe",
+			"/opt/kafka-probe/kafka-probe",
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "kafka-probe",
+				MountPath: "/opt/kafka-probe",
+			},
+		},
+	})
+
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "kafka-probe",
+		MountPath: "/opt/kafka-probe",
+		ReadOnly:  true,
+	})
+	container.ReadinessProbe.Handler = corev1.Handler{
+		Exec: &corev1.ExecAction{
+			Command: []string{
+				"/opt/kafka-probe/kafka-probe",
+				"readiness",
+				"--address",
+				fmt.Sprintf("localhost:%d", kafka.Spec.ContainerPort.Port),
+			},
+		},
+	}
+	container.LivenessProbe.Handler = corev1.Handler{
+		Exec: &corev1.ExecAction{
+			Command: []string{
+				"/opt/kafka-probe/kafka-probe",
+				"liveness",
+			},
+		},
+	}
+	container.Lifecycle = &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					"/opt/kafka-probe/kafka-probe",
+					"shutdown",
+					"--address",
+					fmt.Sprintf("localhost:%d", kafka.Spec.ContainerPort.Port),
+					"--shutdown-timeout",
+					fmt.Sprintf("%ds", getShutdownTimeout(*kafka.Spec.TerminationGracePeriodSeconds)),
+				},
+			},
+		},
+	}
+}
+
+// getShutdownTimeout returns how long preStop hook waits for controlled shutdown, the rest of grace period
+// is left to Kafka to close logs before it is killed
+func getShutdownTimeout(terminationGracePeriodSeconds int64) int64 {
+	if terminationGracePeriodSeconds > 20 {
+		return terminationGracePeriodSeconds - 10
+	}
+	return terminationGracePeriodSeconds / 2
+}
+
+// getZookeeperSecurityConfig returns env, volumes, volume mounts and start command
+// of TLS and SASL connection to zookeeper
+func getZookeeperSecurityConfig(kafka *litekafkav1alpha1.KafkaCluster) ([]corev1.EnvVar, []corev1.Volume, []corev1.VolumeMount, string) {
+	envVars := []corev1.EnvVar{}
+	volumes := []corev1.Volume{}
+	volumeMounts := []corev1.VolumeMount{}
+	startCmd := ""
+	if kafka.Spec.Zookeeper.TLS != nil {
+		envVars = append(envVars, getZookeeperTLSEnv(kafka.Spec.Zookeeper.TLS)...)
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "zookeeper-tls",
+			MountPath: "/etc/kafka/zookeeper-tls",
+			ReadOnly:  true,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: "zookeeper-tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: kafka.Spec.Zookeeper.TLS.SecretName,
+				},
+			},
+		})
+	}
+	if kafka.Spec.Zookeeper.SASL != nil {
+		envVars = append(envVars, getZookeeperSASLEnv(kafka.Spec.Zookeeper.SASL)...)
+		// JAAS file is generated on start, tracing is disabled to keep password out of logs
+		startCmd += ` && set +x && printf 'Client {\n  org.apache.zookeeper.server.auth.DigestLoginModule required\n  username="%s"\n  password="%s";\n};\n' "${ZOOKEEPER_SASL_USERNAME}" "${ZOOKEEPER_SASL_PASSWORD}" > /tmp/zookeeper_jaas.conf && set -x` +
+			` && export KAFKA_OPTS="${KAFKA_OPTS} -Djava.security.auth.login.config=/tmp/zookeeper_jaas.conf"`
+	}
+	if kafka.Spec.Zookeeper.TLS != nil || kafka.Spec.Zookeeper.SASL != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "KAFKA_ZOOKEEPER_SET_ACL",
+			Value: "true",
+		})
+	}
+	return envVars, volumes, volumeMounts, startCmd
+}
+
+// getZookeeperTLSEnv returns broker configuration of TLS connection to zookeeper,
+// keystore and truststore are mounted from TLS secret
+func getZookeeperTLSEnv(tlsSpec *litekafkav1alpha1.ZookeeperTLSSpec) []corev1.EnvVar {
+	password := &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: tlsSpec.SecretName},
+			Key:                  "password",
+		},
+	}
+	return []corev1.EnvVar{
+		{
+			Name:  "KAFKA_ZOOKEEPER_SSL_CLIENT_ENABLE",
+			Value: "true",
+		},
+		{
+			Name:  "KAFKA_ZOOKEEPER_CLIENT_CNXN_SOCKET",
+			Value: "org.apache.zookeeper.ClientCnxnSocketNetty",
+		},
+		{
+			Name:  "KAFKA_ZOOKEEPER_SSL_KEYSTORE_LOCATION",
+			Value: "/etc/kafka/zookeeper-tls/keystore.p12",
+		},
+		{
+			Name:  "KAFKA_ZOOKEEPER_SSL_KEYSTORE_TYPE",
+			Value: "PKCS12",
+		},
+		{
+			Name:      "KAFKA_ZOOKEEPER_SSL_KEYSTORE_PASSWORD",
+			ValueFrom: password,
+		},
+		{
+			Name:  "KAFKA_ZOOKEEPER_SSL_TRUSTSTORE_LOCATION",
+			Value: "/etc/kafka/zookeeper-tls/truststore.p12",
+		},
+		{
+			Name:  "KAFKA_ZOOKEEPER_SSL_TRUSTSTORE_TYPE",
+			Value: "PKCS12",
+		},
+		{
+			Name:      "KAFKA_ZOOKEEPER_SSL_TRUSTSTORE_PASSWORD",
+			ValueFrom: password,
+		},
+	}
+}
+
+// getZookeeperSASLEnv returns credentials of zookeeper Digest authentication from SASL secret
+func getZookeeperSASLEnv(saslSpec *litekafkav1alpha1.ZookeeperSASLSpec) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name: "ZOOKEEPER_SASL_USERNAME",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: saslSpec.SecretName},
+					Key:                  "username",
+				},
+			},
+		},
+		{
+			Name: "ZOOKEEPER_SASL_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: saslSpec.SecretName},
+					Key:                  "password",
+				},
+			},
+		},
+	}
+}
+
 func getKafkaServiceHeadless(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Service {
 	metaData := metav1.ObjectMeta{
 		Namespace: kafka.Namespace,
@@ -194,7 +591,8 @@ func getKafkaServiceHeadless(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Serv
 					Port: kafka.Spec.ServicePort.Port,
 				},
 			},
-			ClusterIP: "None",
+			ClusterIP:                "None",
+			PublishNotReadyAddresses: true,
 			Selector: map[string]string{
 				"app.kubernetes.io/component": "kafka-broker",
 				"app.kubernetes.io/name":      "kafka",
@@ -237,3 +635,31 @@ func getKafkaService(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Service {
 
 	return &service
 }
+
+func getKafkaPodDisruptionBudget(kafka *litekafkav1alpha1.KafkaCluster) *policyv1beta1.PodDisruptionBudget {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-kafka",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "kafka-broker",
+			"app.kubernetes.io/name":      "kafka",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+
+	pdb := policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metaData,
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MaxUnavailable: kafka.Spec.DisruptionBudget.MaxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/component": "kafka-broker",
+					"app.kubernetes.io/name":      "kafka",
+					"app.kubernetes.io/instance":  kafka.Name,
+				},
+			},
+		},
+	}
+
+	return &pdb
+}
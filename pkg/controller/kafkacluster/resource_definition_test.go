@@ -0,0 +1,159 @@
+package kafkacluster
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// Run "go test ./pkg/controller/kafkacluster -update" to regenerate golden files after intended change of manifests
+var update = flag.Bool("update", false, "update golden files")
+
+// goldenSpecs are representative specs of KafkaCluster, generated manifests are compared with testdata/<name>.golden.yaml
+var goldenSpecs = map[string]litekafkav1alpha1.KafkaClusterSpec{
+	"default": {},
+	"scheduling": {
+		Replicas: 5,
+		Storage:  "100Gi",
+		Image:    "confluentinc/cp-kafka:5.3.1",
+		Rack:     &litekafkav1alpha1.RackSpec{TopologyKey: "topology.kubernetes.io/zone"},
+		Template: &litekafkav1alpha1.KafkaTemplate{
+			Pod: &litekafkav1alpha1.PodTemplate{
+				NodeSelector: map[string]string{"node-role.kubernetes.io/kafka": "true"},
+				Tolerations: []corev1.Toleration{
+					{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "kafka", Effect: corev1.TaintEffectNoSchedule},
+				},
+				PriorityClassName: "kafka",
+			},
+		},
+		DisruptionBudget: &litekafkav1alpha1.DisruptionBudgetSpec{
+			MaxUnavailable: &intstr.IntOrString{Type: intstr.Int, IntVal: 2},
+		},
+		TerminationGracePeriodSeconds: &goldenTerminationGracePeriodSeconds,
+		BrokerIDOffset:                100,
+	},
+	"zookeeper-security": {
+		Zookeeper: &litekafkav1alpha1.ZookeeperSpec{
+			Servers: []string{"zk-0.zk:2181", "zk-1.zk:2181", "zk-2.zk:2181"},
+			Chroot:  "kafka/test",
+			TLS:     &litekafkav1alpha1.ZookeeperTLSSpec{SecretName: "zookeeper-tls"},
+			SASL:    &litekafkav1alpha1.ZookeeperSASLSpec{SecretName: "zookeeper-sasl"},
+		},
+	},
+	"kraft": {
+		Mode:  litekafkav1alpha1.ModeKRaft,
+		KRaft: &litekafkav1alpha1.KRaftSpec{ControllerReplicas: 3},
+	},
+	"metrics": {
+		Metrics: &litekafkav1alpha1.MetricsSpec{},
+	},
+	"metrics-javaagent": {
+		Metrics: &litekafkav1alpha1.MetricsSpec{Mode: litekafkav1alpha1.MetricsModeJavaAgent},
+	},
+}
+
+// goldenTerminationGracePeriodSeconds is long enough for controlled shutdown of big broker
+var goldenTerminationGracePeriodSeconds = int64(300)
+
+// goldenProbeImage is used by all specs, so probes of kafka-probe are covered
+const goldenProbeImage = "lite-kafka-operator:test"
+
+func TestGetBrokerIDs(t *testing.T) {
+	kafka := &litekafkav1alpha1.KafkaCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+		Spec:       litekafkav1alpha1.KafkaClusterSpec{Replicas: 4, BrokerIDOffset: 10},
+	}
+	// Pod 1 was replaced by broker 12 and pod 5 is scaled down, their IDs are kept
+	existing := map[string]string{"test-kafka-0": "10", "test-kafka-1": "12", "test-kafka-5": "15"}
+
+	expected := map[string]string{
+		"test-kafka-0": "10",
+		"test-kafka-1": "12",
+		"test-kafka-2": "13",
+		"test-kafka-3": "14",
+		"test-kafka-5": "15",
+	}
+	if brokerIDs := getBrokerIDs(kafka, existing); !reflect.DeepEqual(brokerIDs, expected) {
+		t.Errorf("expected broker IDs %v, got %v", expected, brokerIDs)
+	}
+}
+
+func TestGoldenManifests(t *testing.T) {
+	for name, spec := range goldenSpecs {
+		t.Run(name, func(t *testing.T) {
+			kafka := &litekafkav1alpha1.KafkaCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+				Spec:       *spec.DeepCopy(),
+			}
+			kafka.SetDefaults()
+			kafka.Status.Mode = kafka.Spec.Mode
+			kafka.Status.ClusterID = "MkU3OEVBNTcwNTJENDM2Qg"
+
+			objs := []interface{}{
+				getKafkaStatefulSet(kafka, goldenProbeImage),
+				getKafkaService(kafka),
+				getKafkaServiceHeadless(kafka),
+				getKafkaPodDisruptionBudget(kafka),
+			}
+			if hasBrokerIDs(kafka) {
+				objs = append(objs, getKafkaBrokerIDsConfigMap(kafka, getBrokerIDs(kafka, nil)))
+			}
+			if kafka.Spec.Mode == litekafkav1alpha1.ModeKRaft && kafka.Spec.KRaft.ControllerReplicas > 0 {
+				objs = append(objs, getKafkaControllerStatefulSet(kafka), getKafkaControllerServiceHeadless(kafka))
+			}
+			if kafka.Spec.Metrics != nil {
+				objs = append(objs, getKafkaMetricsService(kafka), getKafkaMetricsConfigMap(kafka))
+			}
+
+			var manifests [][]byte
+			for _, obj := range objs {
+				data, err := yaml.Marshal(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				manifests = append(manifests, data)
+			}
+			actual := bytes.Join(manifests, []byte("---\n"))
+
+			golden := filepath.Join("testdata", name+".golden.yaml")
+			if *update {
+				if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("cannot read golden file, run tests with -update to create it: %v", err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("manifests differ from %s, run tests with -update and review the diff:\n%s", golden, actual)
+			}
+		})
+	}
+}
+
+func TestKafkaProbesWithoutProbeImage(t *testing.T) {
+	kafka := &litekafkav1alpha1.KafkaCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace},
+	}
+	kafka.SetDefaults()
+
+	container := getKafkaStatefulSet(kafka, "").Spec.Template.Spec.Containers[0]
+	for name, probe := range map[string]*corev1.Probe{"liveness": container.LivenessProbe, "readiness": container.ReadinessProbe} {
+		if probe.Exec != nil || probe.TCPSocket == nil || probe.TCPSocket.Port.IntValue() != int(kafka.Spec.ContainerPort.Port) {
+			t.Errorf("expected %s probe on TCP port %d, got %+v", name, kafka.Spec.ContainerPort.Port, probe.Handler)
+		}
+	}
+	if container.Lifecycle != nil {
+		t.Errorf("expected no preStop hook without kafka-probe, got %+v", container.Lifecycle)
+	}
+}
@@ -0,0 +1,186 @@
+package kafkacluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// teardownFinalizer keeps KafkaCluster until operator cleans up after cluster
+const teardownFinalizer = "litekafka.operator.mirantis.com/teardown"
+
+// addTeardownFinalizer adds finalizer to cluster which is not being deleted
+func (r *ReconcileKafkaCluster) addTeardownFinalizer(kafka *litekafkav1alpha1.KafkaCluster) error {
+	if kafka.DeletionTimestamp != nil || containsString(kafka.Finalizers, teardownFinalizer) {
+		return nil
+	}
+	return r.updateFinalizers(kafka, func(finalizers []string) []string {
+		return append(finalizers, teardownFinalizer)
+	})
+}
+
+// updateFinalizers changes finalizers of stored cluster only, so defaults set in kafka are never
+// written into its spec, kafka gets changed finalizers and resource version
+func (r *ReconcileKafkaCluster) updateFinalizers(kafka *litekafkav1alpha1.KafkaCluster, change func([]string) []string) error {
+	stored := &litekafkav1alpha1.KafkaCluster{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: kafka.Name, Namespace: kafka.Namespace}, stored)
+	if err != nil {
+		return err
+	}
+	stored.Finalizers = change(stored.Finalizers)
+	if err = r.client.Update(context.TODO(), stored); err != nil {
+		return err
+	}
+	kafka.Finalizers = stored.Finalizers
+	kafka.ResourceVersion = stored.ResourceVersion
+	return nil
+}
+
+// reconcileDeletion stops brokers one by one, deletes data of cluster according to spec.deletion
+// and releases KafkaCluster, owned resources are deleted by garbage collector afterwards
+func (r *ReconcileKafkaCluster) reconcileDeletion(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (reconcile.Result, error) {
+	if !containsString(kafka.Finalizers, teardownFinalizer) {
+		return reconcile.Result{}, nil
+	}
+	rlog.Info("Tearing down KafkaCluster")
+
+	// Brokers are stopped before controllers, so they shut down with active controller
+	for _, name := range []string{kafka.Name + "-kafka", kafka.Name + "-controller"} {
+		done, err := r.scaleDownStatefulSet(kafka, rlog, name)
+		if err != nil {
+			r.reconcileFailed(kafka, rlog, err, "Cannot scale down "+name)
+			return reconcile.Result{}, err
+		}
+		if !done {
+			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+	}
+
+	if err := r.deleteZookeeperData(kafka, rlog); err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot delete Zookeeper data of cluster")
+		return reconcile.Result{}, err
+	}
+	if err := r.deletePersistentVolumeClaims(kafka, rlog); err != nil {
+		r.reconcileFailed(kafka, rlog, err, "Cannot delete PersistentVolumeClaims of cluster")
+		return reconcile.Result{}, err
+	}
+
+	rlog.Info("Teardown of KafkaCluster completed")
+	r.recorder.Event(kafka, corev1.EventTypeNormal, "TeardownCompleted", "Brokers are stopped and data of cluster are cleaned up")
+	return reconcile.Result{}, r.updateFinalizers(kafka, func(finalizers []string) []string {
+		return removeString(finalizers, teardownFinalizer)
+	})
+}
+
+// scaleDownStatefulSet removes pods of StatefulSet one by one, highest ordinal first, so every broker
+// does controlled shutdown while the rest of cluster is running, it returns true when no pod is left
+func (r *ReconcileKafkaCluster) scaleDownStatefulSet(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger, name string) (bool, error) {
+	sts := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: kafka.Namespace}, sts)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	pods := &corev1.PodList{}
+	err = r.client.List(context.TODO(), client.InNamespace(sts.Namespace).MatchingLabels(sts.Spec.Selector.MatchLabels), pods)
+	if err != nil {
+		return false, err
+	}
+	if sts.Status.Replicas > *sts.Spec.Replicas || int32(len(pods.Items)) > *sts.Spec.Replicas {
+		rlog.Info("Waiting for pods of StatefulSet to terminate", "Name", sts.Name, "Pods", len(pods.Items))
+		return false, nil
+	}
+	if *sts.Spec.Replicas == 0 {
+		return true, nil
+	}
+
+	replicas := *sts.Spec.Replicas - 1
+	rlog.Info("Scaling down StatefulSet", "Namespace", sts.Namespace, "Name", sts.Name, "Replicas", replicas)
+	change := fmt.Sprintf("replicas %d -> %d for deletion of cluster", *sts.Spec.Replicas, replicas)
+	sts.Spec.Replicas = &replicas
+	return false, r.updateResource(kafka, sts, "StatefulSet", sts.Name, "Scaled", change)
+}
+
+// deleteZookeeperData deletes chroot znode of cluster with all metadata of brokers
+func (r *ReconcileKafkaCluster) deleteZookeeperData(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) error {
+	if !kafka.Spec.Deletion.DeleteZookeeperData || kafka.Status.Mode == litekafkav1alpha1.ModeKRaft {
+		return nil
+	}
+	chroot := kafka.Spec.Zookeeper.Chroot
+	if len(chroot) == 0 {
+		// Root of ensemble can be shared by other clusters and applications
+		rlog.Info("Skip deletion of Zookeeper data: chroot is not set")
+		r.recorder.Event(kafka, corev1.EventTypeWarning, "ZookeeperDataRetained", "Zookeeper data are deleted only under spec.zookeeper.chroot")
+		return nil
+	}
+
+	zkClient, err := r.newZookeeperClient(kafka)
+	if err != nil {
+		return err
+	}
+	defer zkClient.Close()
+	rlog.Info("Deleting Zookeeper data of cluster", "Chroot", chroot)
+	if err = zkClient.DeleteRecursive(chroot); err != nil {
+		return err
+	}
+	r.recorder.Eventf(kafka, corev1.EventTypeNormal, "ZookeeperDataDeleted", "Deleted Zookeeper chroot %s", chroot)
+	return nil
+}
+
+// deletePersistentVolumeClaims deletes claims of brokers, controllers and managed zookeeper when policy is Delete
+func (r *ReconcileKafkaCluster) deletePersistentVolumeClaims(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) error {
+	if kafka.Spec.Deletion.PersistentVolumeClaims != litekafkav1alpha1.PersistentVolumeClaimsDelete {
+		return nil
+	}
+
+	// StatefulSets label claims with their selector
+	claims := &corev1.PersistentVolumeClaimList{}
+	labels := map[string]string{"app.kubernetes.io/instance": kafka.Name}
+	err := r.client.List(context.TODO(), client.InNamespace(kafka.Namespace).MatchingLabels(labels), claims)
+	if err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if name := claim.Labels["app.kubernetes.io/name"]; name != "kafka" && name != "zookeeper" {
+			continue
+		}
+		rlog.Info("Deleting PersistentVolumeClaim", "Namespace", claim.Namespace, "Name", claim.Name)
+		if err = r.deleteResource(kafka, claim, "PersistentVolumeClaim", claim.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsString returns true when slice contains s
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns slice without all occurrences of s
+func removeString(slice []string, s string) []string {
+	result := []string{}
+	for _, item := range slice {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package kafkacluster
+
+import (
+	"fmt"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// zookeeperMaxBrokerID is default reserved.broker.max.id, IDs above it are generated by zookeeper
+const zookeeperMaxBrokerID = 1000
+
+// validateSpec returns reason and message when spec cannot be applied to running cluster
+func validateSpec(kafka *litekafkav1alpha1.KafkaCluster) (string, string) {
+	if quorum := kafka.Status.KRaft; quorum != nil {
+		if kafka.Spec.KRaft.ControllerReplicas != quorum.ControllerReplicas {
+			return "KRaftQuorumChanged", fmt.Sprintf("spec.kraft.controllerReplicas cannot be changed from %d, voters of KRaft quorum are static",
+				quorum.ControllerReplicas)
+		}
+		if quorum.ControllerReplicas == 0 && kafka.Spec.Replicas < quorum.Voters {
+			return "KRaftQuorumChanged", fmt.Sprintf("brokers cannot be scaled below %d, they are voters of KRaft quorum", quorum.Voters)
+		}
+	}
+	maxBrokerID := kafka.Spec.BrokerIDOffset + kafka.Spec.Replicas - 1
+	if kafka.Spec.BrokerIDOffset < 0 {
+		return "InvalidBrokerIDOffset", fmt.Sprintf("spec.brokerIdOffset %d is negative", kafka.Spec.BrokerIDOffset)
+	}
+	// Brokers registered in zookeeper keep their IDs after migration, so limit of zookeeper applies until it is finished
+	if getBrokerMode(kafka) != litekafkav1alpha1.ModeKRaft && maxBrokerID > zookeeperMaxBrokerID {
+		return "InvalidBrokerIDOffset", fmt.Sprintf("spec.brokerIdOffset %d gives broker IDs up to %d, IDs above %d are reserved by zookeeper",
+			kafka.Spec.BrokerIDOffset, maxBrokerID, zookeeperMaxBrokerID)
+	}
+	if maxBrokerID >= kraftControllerIDOffset {
+		return "InvalidBrokerIDOffset", fmt.Sprintf("spec.brokerIdOffset %d gives broker IDs up to %d, IDs from %d are used by KRaft controllers",
+			kafka.Spec.BrokerIDOffset, maxBrokerID, kraftControllerIDOffset)
+	}
+	return "", ""
+}
+
+// checkSpec reports rejected spec by SpecValid condition and warning event, it returns false when spec is rejected
+func (r *ReconcileKafkaCluster) checkSpec(kafka *litekafkav1alpha1.KafkaCluster, rlog logr.Logger) (bool, error) {
+	status := kafka.Status.DeepCopy()
+	reason, message := validateSpec(kafka)
+	condition := kafka.Status.GetCondition(litekafkav1alpha1.ConditionSpecValid)
+	if len(reason) > 0 {
+		if condition == nil || condition.Status != corev1.ConditionFalse || condition.Message != message {
+			rlog.Info("Spec of cluster is rejected", "Reason", reason, "Message", message)
+			r.recorder.Event(kafka, corev1.EventTypeWarning, reason, message)
+		}
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionSpecValid, corev1.ConditionFalse, reason, message)
+	} else if condition != nil {
+		kafka.Status.SetCondition(litekafkav1alpha1.ConditionSpecValid, corev1.ConditionTrue, "Valid", "Spec is applied to cluster")
+	}
+	return len(reason) == 0, r.updateStatus(kafka, status)
+}
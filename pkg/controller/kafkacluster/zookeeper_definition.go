@@ -0,0 +1,310 @@
+package kafkacluster
+
+import (
+	"fmt"
+	"strings"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	zookeeperPeerPort     = 2888
+	zookeeperElectionPort = 3888
+)
+
+// getZookeeperServers returns server.N entries of managed ensemble of given size, myid of pod is its ordinal + 1
+func getZookeeperServers(kafka *litekafkav1alpha1.KafkaCluster, replicas int32) string {
+	servers := []string{}
+	for i := int32(0); i < replicas; i++ {
+		servers = append(servers, fmt.Sprintf("server.%d=%s:%d:%d;%d",
+			i+1, getZookeeperMemberHost(kafka, i), zookeeperPeerPort, zookeeperElectionPort, kafka.Spec.Zookeeper.Port.Port))
+	}
+	return strings.Join(servers, " ")
+}
+
+// getZookeeperMembers returns client addresses of members of managed ensemble of given size
+func getZookeeperMembers(kafka *litekafkav1alpha1.KafkaCluster, replicas int32) []string {
+	members := []string{}
+	for i := int32(0); i < replicas; i++ {
+		members = append(members, fmt.Sprintf("%s:%d", getZookeeperMemberHost(kafka, i), kafka.Spec.Zookeeper.Port.Port))
+	}
+	return members
+}
+
+func getZookeeperMemberHost(kafka *litekafkav1alpha1.KafkaCluster, ordinal int32) string {
+	return fmt.Sprintf("%s-zookeeper-%d.%s-zookeeper-headless.%s.svc", kafka.Name, ordinal, kafka.Name, kafka.Namespace)
+}
+
+// getZookeeperStatefulSet returns managed ensemble of given size, it differs from spec while ensemble is scaled
+// member by member
+func getZookeeperStatefulSet(kafka *litekafkav1alpha1.KafkaCluster, replicas int32) *appsv1.StatefulSet {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-zookeeper",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "zookeeper",
+			"app.kubernetes.io/name":      "zookeeper",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+	selectors := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app.kubernetes.io/component": "zookeeper",
+			"app.kubernetes.io/name":      "zookeeper",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+	terminationGracePeriodSeconds := int64(30)
+	livenessProbe := &corev1.Probe{
+		Handler: corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt(int(kafka.Spec.Zookeeper.Port.Port)),
+			},
+		},
+		InitialDelaySeconds: 30,
+		TimeoutSeconds:      5,
+	}
+	// Server listens on client port before quorum is formed, so pods of ordered StatefulSet
+	// can start one by one. Quorum itself is checked by operator.
+	readinessProbe := &corev1.Probe{
+		Handler: corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt(int(kafka.Spec.Zookeeper.Port.Port)),
+			},
+		},
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      5,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
+	}
+	volumeClaimTemplate := []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "datadir",
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse(kafka.Spec.Zookeeper.Storage),
+					},
+				},
+			},
+		},
+	}
+	envVars := []corev1.EnvVar{
+		{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: "metadata.name",
+				},
+			},
+		},
+		{
+			Name:  "ZOO_SERVERS",
+			Value: getZookeeperServers(kafka, replicas),
+		},
+		{
+			Name:  "ZOO_4LW_COMMANDS_WHITELIST",
+			Value: "ruok,srvr,mntr",
+		},
+		{
+			Name:  "ZOO_CFG_EXTRA",
+			Value: "quorumListenOnAllIPs=true",
+		},
+		{
+			Name:  "ZOO_DATA_DIR",
+			Value: "/data",
+		},
+		{
+			Name:  "ZOO_DATA_LOG_DIR",
+			Value: "/data/log",
+		},
+	}
+
+	sts := appsv1.StatefulSet{
+		ObjectMeta: metaData,
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            &replicas,
+			Selector:            selectors,
+			PodManagementPolicy: "OrderedReady",
+			ServiceName:         kafka.Name + "-zookeeper-headless",
+			// Members read server list on start, operator restarts them one by one while ensemble keeps quorum
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: "OnDelete",
+			},
+			VolumeClaimTemplates: volumeClaimTemplate,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metaData,
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+								{
+									Weight: 100,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: selectors,
+										TopologyKey:   "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            "zookeeper",
+							Image:           kafka.Spec.Zookeeper.Image,
+							ImagePullPolicy: "IfNotPresent",
+							LivenessProbe:   livenessProbe,
+							ReadinessProbe:  readinessProbe,
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "client",
+									ContainerPort: kafka.Spec.Zookeeper.Port.Port,
+								},
+								{
+									Name:          "peer",
+									ContainerPort: zookeeperPeerPort,
+								},
+								{
+									Name:          "election",
+									ContainerPort: zookeeperElectionPort,
+								},
+							},
+							Env: envVars,
+							Command: []string{
+								`sh`,
+								`-exc`,
+								`mkdir -p ${ZOO_DATA_LOG_DIR} && export ZOO_MY_ID=$((${POD_NAME##*-} + 1)) && exec /docker-entrypoint.sh zkServer.sh start-foreground`,
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "datadir",
+									MountPath: "/data",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	sts.Annotations = map[string]string{
+		templateHashAnnotation: getPodTemplateHash(&sts.Spec.Template),
+	}
+	return &sts
+}
+
+func getZookeeperServiceHeadless(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Service {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-zookeeper-headless",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "zookeeper",
+			"app.kubernetes.io/name":      "zookeeper",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+		Annotations: map[string]string{
+			"service.alpha.kubernetes.io/tolerate-unready-endpoints": "true",
+		},
+	}
+
+	service := corev1.Service{
+		ObjectMeta: metaData,
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name: "client",
+					Port: kafka.Spec.Zookeeper.Port.Port,
+				},
+				{
+					Name: "peer",
+					Port: zookeeperPeerPort,
+				},
+				{
+					Name: "election",
+					Port: zookeeperElectionPort,
+				},
+			},
+			ClusterIP:                "None",
+			PublishNotReadyAddresses: true,
+			Selector: map[string]string{
+				"app.kubernetes.io/component": "zookeeper",
+				"app.kubernetes.io/name":      "zookeeper",
+				"app.kubernetes.io/instance":  kafka.Name,
+			},
+		},
+	}
+
+	return &service
+}
+
+func getZookeeperService(kafka *litekafkav1alpha1.KafkaCluster) *corev1.Service {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-zookeeper",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "zookeeper",
+			"app.kubernetes.io/name":      "zookeeper",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+
+	service := corev1.Service{
+		ObjectMeta: metaData,
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       kafka.Spec.Zookeeper.Port.Name,
+					Port:       kafka.Spec.Zookeeper.Port.Port,
+					TargetPort: intstr.FromString("client"),
+				},
+			},
+			Selector: map[string]string{
+				"app.kubernetes.io/component": "zookeeper",
+				"app.kubernetes.io/name":      "zookeeper",
+				"app.kubernetes.io/instance":  kafka.Name,
+			},
+		},
+	}
+
+	return &service
+}
+
+func getZookeeperPodDisruptionBudget(kafka *litekafkav1alpha1.KafkaCluster) *policyv1beta1.PodDisruptionBudget {
+	metaData := metav1.ObjectMeta{
+		Namespace: kafka.Namespace,
+		Name:      kafka.Name + "-zookeeper",
+		Labels: map[string]string{
+			"app.kubernetes.io/component": "zookeeper",
+			"app.kubernetes.io/name":      "zookeeper",
+			"app.kubernetes.io/instance":  kafka.Name,
+		},
+	}
+	maxUnavailable := intstr.FromInt(1)
+
+	pdb := policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metaData,
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/component": "zookeeper",
+					"app.kubernetes.io/name":      "zookeeper",
+					"app.kubernetes.io/instance":  kafka.Name,
+				},
+			},
+		},
+	}
+
+	return &pdb
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"github.com/Svimba/lite-kafka-operator/pkg/apis"
+	monitoringv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// NewManager creates Manager with all resources of operator registered in its Scheme and all Controllers added,
+// it is used by cmd/manager and integration tests
+func NewManager(cfg *rest.Config, options manager.Options) (manager.Manager, error) {
+	mgr, err := manager.New(cfg, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup Scheme for all resources
+	if err = apis.AddToScheme(mgr.GetScheme()); err != nil {
+		return nil, err
+	}
+	// ServiceMonitors and PrometheusRules of clusters are managed when prometheus-operator is installed
+	if err = monitoringv1.AddToScheme(mgr.GetScheme()); err != nil {
+		return nil, err
+	}
+
+	// Setup all Controllers
+	if err = AddToManager(mgr); err != nil {
+		return nil, err
+	}
+	return mgr, nil
+}
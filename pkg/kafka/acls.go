@@ -0,0 +1,178 @@
+package kafka
+
+import (
+	"fmt"
+)
+
+const (
+	apiKeyDescribeACLs     = 29
+	apiVersionDescribeACLs = 0
+	apiKeyCreateACLs       = 30
+	apiVersionCreateACLs   = 0
+	apiKeyDeleteACLs       = 31
+	apiVersionDeleteACLs   = 0
+)
+
+// ACLOperation is an operation allowed or denied by ACL
+type ACLOperation int8
+
+// ACL operations
+const (
+	ACLOperationAny             ACLOperation = 1
+	ACLOperationAll             ACLOperation = 2
+	ACLOperationRead            ACLOperation = 3
+	ACLOperationWrite           ACLOperation = 4
+	ACLOperationCreate          ACLOperation = 5
+	ACLOperationDelete          ACLOperation = 6
+	ACLOperationAlter           ACLOperation = 7
+	ACLOperationDescribe        ACLOperation = 8
+	ACLOperationClusterAction   ACLOperation = 9
+	ACLOperationDescribeConfigs ACLOperation = 10
+	ACLOperationAlterConfigs    ACLOperation = 11
+	ACLOperationIdempotentWrite ACLOperation = 12
+)
+
+// ACLPermission is a permission type of ACL
+type ACLPermission int8
+
+// ACL permission types
+const (
+	ACLPermissionAny   ACLPermission = 1
+	ACLPermissionDeny  ACLPermission = 2
+	ACLPermissionAllow ACLPermission = 3
+)
+
+// ACL is a literal ACL of resource, as a filter empty strings and Any types match all ACLs
+type ACL struct {
+	ResourceType ResourceType
+	ResourceName string
+	Principal    string
+	Host         string
+	Operation    ACLOperation
+	Permission   ACLPermission
+}
+
+// Matches returns true when filter matches acl
+func (filter ACL) Matches(acl ACL) bool {
+	return (filter.ResourceType == ResourceTypeAny || filter.ResourceType == acl.ResourceType) &&
+		(len(filter.ResourceName) == 0 || filter.ResourceName == acl.ResourceName) &&
+		(len(filter.Principal) == 0 || filter.Principal == acl.Principal) &&
+		(len(filter.Host) == 0 || filter.Host == acl.Host) &&
+		(filter.Operation == ACLOperationAny || filter.Operation == acl.Operation) &&
+		(filter.Permission == ACLPermissionAny || filter.Permission == acl.Permission)
+}
+
+// DescribeACLs returns ACLs matching filter
+func (c *Conn) DescribeACLs(filter ACL) ([]ACL, error) {
+	request := &encoder{}
+	putACLFilter(request, filter)
+
+	response, err := c.request(apiKeyDescribeACLs, apiVersionDescribeACLs, request.data)
+	if err != nil {
+		return nil, err
+	}
+	// Throttle time
+	response.getInt32()
+	requestErr := newError(response.getInt16(), response.getString())
+	var acls []ACL
+	for i := response.getArrayLength(); i > 0; i-- {
+		resourceType := ResourceType(response.getInt8())
+		resourceName := response.getString()
+		for j := response.getArrayLength(); j > 0; j-- {
+			acls = append(acls, ACL{
+				ResourceType: resourceType,
+				ResourceName: resourceName,
+				Principal:    response.getString(),
+				Host:         response.getString(),
+				Operation:    ACLOperation(response.getInt8()),
+				Permission:   ACLPermission(response.getInt8()),
+			})
+		}
+	}
+	if response.err != nil {
+		return nil, fmt.Errorf("cannot decode ACLs: %v", response.err)
+	}
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	return acls, nil
+}
+
+// CreateACLs creates ACLs, first error is returned
+func (c *Conn) CreateACLs(acls []ACL) error {
+	request := &encoder{}
+	request.putInt32(int32(len(acls)))
+	for _, acl := range acls {
+		request.putInt8(int8(acl.ResourceType))
+		request.putString(acl.ResourceName)
+		request.putString(acl.Principal)
+		request.putString(acl.Host)
+		request.putInt8(int8(acl.Operation))
+		request.putInt8(int8(acl.Permission))
+	}
+
+	response, err := c.request(apiKeyCreateACLs, apiVersionCreateACLs, request.data)
+	if err != nil {
+		return err
+	}
+	// Throttle time
+	response.getInt32()
+	var creationErr error
+	for i := response.getArrayLength(); i > 0; i-- {
+		if err := newError(response.getInt16(), response.getString()); err != nil && creationErr == nil {
+			creationErr = err
+		}
+	}
+	if response.err != nil {
+		return fmt.Errorf("cannot decode response of ACLs: %v", response.err)
+	}
+	return creationErr
+}
+
+// DeleteACLs deletes ACLs matching filter and returns them
+func (c *Conn) DeleteACLs(filter ACL) ([]ACL, error) {
+	request := &encoder{}
+	request.putInt32(1)
+	putACLFilter(request, filter)
+
+	response, err := c.request(apiKeyDeleteACLs, apiVersionDeleteACLs, request.data)
+	if err != nil {
+		return nil, err
+	}
+	// Throttle time
+	response.getInt32()
+	var deleted []ACL
+	var deletionErr error
+	for i := response.getArrayLength(); i > 0; i-- {
+		if err := newError(response.getInt16(), response.getString()); err != nil && deletionErr == nil {
+			deletionErr = err
+		}
+		for j := response.getArrayLength(); j > 0; j-- {
+			if err := newError(response.getInt16(), response.getString()); err != nil && deletionErr == nil {
+				deletionErr = err
+			}
+			deleted = append(deleted, ACL{
+				ResourceType: ResourceType(response.getInt8()),
+				ResourceName: response.getString(),
+				Principal:    response.getString(),
+				Host:         response.getString(),
+				Operation:    ACLOperation(response.getInt8()),
+				Permission:   ACLPermission(response.getInt8()),
+			})
+		}
+	}
+	if response.err != nil {
+		return nil, fmt.Errorf("cannot decode response of ACLs: %v", response.err)
+	}
+	return deleted, deletionErr
+}
+
+// putACLFilter writes filter of DescribeACLs and DeleteACLs, empty strings are null and match all
+func putACLFilter(request *encoder, filter ACL) {
+	request.putInt8(int8(filter.ResourceType))
+	request.putNullableString(filter.ResourceName)
+	request.putNullableString(filter.Principal)
+	request.putNullableString(filter.Host)
+	request.putInt8(int8(filter.Operation))
+	request.putInt8(int8(filter.Permission))
+}
@@ -0,0 +1,186 @@
+// Package admin manages Kafka cluster through brokers, Client is injected into reconciler,
+// so it can be replaced by fake one in tests
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka"
+)
+
+// Client manages topics, configs, ACLs and reassignments of cluster
+type Client interface {
+	// DescribeCluster returns brokers, controller and topics of cluster
+	DescribeCluster() (*kafka.Metadata, error)
+	CreateTopic(topic kafka.TopicSpec) error
+	DeleteTopic(name string) error
+	DescribeConfigs(resource kafka.ConfigResource) ([]kafka.ConfigEntry, error)
+	// AlterConfigs replaces configs of resource, configs which are not given are reset to default
+	AlterConfigs(resource kafka.ConfigResource, configs map[string]string) error
+	DescribeACLs(filter kafka.ACL) ([]kafka.ACL, error)
+	CreateACLs(acls []kafka.ACL) error
+	DeleteACLs(filter kafka.ACL) ([]kafka.ACL, error)
+	AlterPartitionReassignments(reassignments kafka.Reassignments) error
+	ListPartitionReassignments() (kafka.Reassignments, error)
+	Close() error
+}
+
+// Factory connects Client to cluster by bootstrap address
+type Factory func(ctx context.Context, address string) (Client, error)
+
+// client sends requests to bootstrap broker, requests of controller or of single broker are sent to it
+type client struct {
+	timeout   time.Duration
+	bootstrap *kafka.Conn
+	brokers   map[int32]*kafka.Conn
+}
+
+// blank assignment to verify that client implements Client
+var _ Client = &client{}
+
+// NewFactory returns Factory of clients connected over plaintext listener, timeout is applied to every request
+func NewFactory(timeout time.Duration) Factory {
+	return func(ctx context.Context, address string) (Client, error) {
+		return NewClient(ctx, address, timeout)
+	}
+}
+
+// NewClient connects to broker on address
+func NewClient(ctx context.Context, address string, timeout time.Duration) (Client, error) {
+	conn, err := kafka.Dial(ctx, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		timeout:   timeout,
+		bootstrap: conn,
+		brokers:   map[int32]*kafka.Conn{},
+	}, nil
+}
+
+// Close closes all connections
+func (c *client) Close() error {
+	err := c.bootstrap.Close()
+	for id, conn := range c.brokers {
+		conn.Close()
+		delete(c.brokers, id)
+	}
+	return err
+}
+
+func (c *client) DescribeCluster() (*kafka.Metadata, error) {
+	return c.bootstrap.Metadata()
+}
+
+func (c *client) CreateTopic(topic kafka.TopicSpec) error {
+	conn, err := c.controller()
+	if err != nil {
+		return err
+	}
+	return conn.CreateTopic(topic)
+}
+
+func (c *client) DeleteTopic(name string) error {
+	conn, err := c.controller()
+	if err != nil {
+		return err
+	}
+	return conn.DeleteTopic(name)
+}
+
+func (c *client) DescribeConfigs(resource kafka.ConfigResource) ([]kafka.ConfigEntry, error) {
+	conn, err := c.resource(resource)
+	if err != nil {
+		return nil, err
+	}
+	return conn.DescribeConfigs(resource)
+}
+
+func (c *client) AlterConfigs(resource kafka.ConfigResource, configs map[string]string) error {
+	conn, err := c.resource(resource)
+	if err != nil {
+		return err
+	}
+	return conn.AlterConfigs(resource, configs)
+}
+
+func (c *client) DescribeACLs(filter kafka.ACL) ([]kafka.ACL, error) {
+	return c.bootstrap.DescribeACLs(filter)
+}
+
+func (c *client) CreateACLs(acls []kafka.ACL) error {
+	return c.bootstrap.CreateACLs(acls)
+}
+
+func (c *client) DeleteACLs(filter kafka.ACL) ([]kafka.ACL, error) {
+	return c.bootstrap.DeleteACLs(filter)
+}
+
+func (c *client) AlterPartitionReassignments(reassignments kafka.Reassignments) error {
+	conn, err := c.controller()
+	if err != nil {
+		return err
+	}
+	return conn.AlterPartitionReassignments(reassignments)
+}
+
+func (c *client) ListPartitionReassignments() (kafka.Reassignments, error) {
+	conn, err := c.controller()
+	if err != nil {
+		return nil, err
+	}
+	return conn.ListPartitionReassignments()
+}
+
+// controller returns connection to controller, brokers in KRaft mode report random broker
+// as controller and forward requests to active controller
+func (c *client) controller() (*kafka.Conn, error) {
+	metadata, err := c.bootstrap.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	if metadata.ControllerID < 0 {
+		return nil, fmt.Errorf("cluster has no active controller")
+	}
+	return c.broker(metadata, metadata.ControllerID)
+}
+
+// resource returns connection to broker of config resource or bootstrap connection for other resources
+func (c *client) resource(resource kafka.ConfigResource) (*kafka.Conn, error) {
+	if resource.Type != kafka.ResourceTypeBroker || len(resource.Name) == 0 {
+		return c.bootstrap, nil
+	}
+	id, err := strconv.ParseInt(resource.Name, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker ID %s: %v", resource.Name, err)
+	}
+	metadata, err := c.bootstrap.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	return c.broker(metadata, int32(id))
+}
+
+// broker returns cached connection to broker by its advertised address
+func (c *client) broker(metadata *kafka.Metadata, id int32) (*kafka.Conn, error) {
+	if conn, ok := c.brokers[id]; ok {
+		return conn, nil
+	}
+	for _, broker := range metadata.Brokers {
+		if broker.ID != id {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), c.timeout)
+		defer cancel()
+		conn, err := kafka.Dial(ctx, fmt.Sprintf("%s:%d", broker.Host, broker.Port), c.timeout)
+		if err != nil {
+			return nil, err
+		}
+		c.brokers[id] = conn
+		return conn, nil
+	}
+	return nil, fmt.Errorf("broker %d is not registered in cluster", id)
+}
@@ -0,0 +1,339 @@
+// Package fake implements admin.Client by in-memory cluster, so controller logic can be tested without Kafka
+package fake
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka"
+	"github.com/Svimba/lite-kafka-operator/pkg/kafka/admin"
+)
+
+// Client is an in-memory cluster, its fields can be set by tests before it is used
+type Client struct {
+	mu sync.Mutex
+	// Err is returned by every request and by Factory when it is set
+	Err          error
+	Brokers      []kafka.Broker
+	ControllerID int32
+	// Topics are replicas of partitions by topic, leader is first live replica
+	Topics        map[string]map[int32][]int32
+	Configs       map[kafka.ConfigResource]map[string]string
+	ACLs          []kafka.ACL
+	Reassignments kafka.Reassignments
+}
+
+// blank assignment to verify that Client implements admin.Client
+var _ admin.Client = &Client{}
+
+// NewClient returns cluster of live brokers with given IDs, first broker is controller
+func NewClient(brokerIDs ...int32) *Client {
+	c := &Client{
+		ControllerID:  -1,
+		Topics:        map[string]map[int32][]int32{},
+		Configs:       map[kafka.ConfigResource]map[string]string{},
+		Reassignments: kafka.Reassignments{},
+	}
+	for _, id := range brokerIDs {
+		c.Brokers = append(c.Brokers, kafka.Broker{ID: id, Host: "localhost", Port: 9092})
+	}
+	if len(brokerIDs) > 0 {
+		c.ControllerID = brokerIDs[0]
+	}
+	return c
+}
+
+// Factory returns factory which connects always to this client
+func (c *Client) Factory() admin.Factory {
+	return func(ctx context.Context, address string) (admin.Client, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.Err != nil {
+			return nil, c.Err
+		}
+		return c, nil
+	}
+}
+
+// Close keeps state of cluster, client can be used again
+func (c *Client) Close() error {
+	return nil
+}
+
+func (c *Client) DescribeCluster() (*kafka.Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+
+	metadata := &kafka.Metadata{
+		Brokers:      append([]kafka.Broker{}, c.Brokers...),
+		ControllerID: c.ControllerID,
+	}
+	for _, name := range c.topicNames() {
+		topic := kafka.Topic{Name: name}
+		for _, id := range partitionIDs(c.Topics[name]) {
+			partition := kafka.Partition{ID: id, Leader: -1, Replicas: c.Topics[name][id], ISR: []int32{}}
+			for _, replica := range partition.Replicas {
+				if !c.isLive(replica) {
+					continue
+				}
+				if partition.Leader < 0 {
+					partition.Leader = replica
+				}
+				partition.ISR = append(partition.ISR, replica)
+			}
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		metadata.Topics = append(metadata.Topics, topic)
+	}
+	return metadata, nil
+}
+
+func (c *Client) CreateTopic(topic kafka.TopicSpec) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	if _, ok := c.Topics[topic.Name]; ok {
+		return &kafka.Error{Code: kafka.ErrTopicAlreadyExists}
+	}
+
+	assignment := map[int32][]int32{}
+	if len(topic.ReplicaAssignment) > 0 {
+		for partition, replicas := range topic.ReplicaAssignment {
+			assignment[partition] = append([]int32{}, replicas...)
+		}
+	} else {
+		if topic.Partitions <= 0 {
+			return &kafka.Error{Code: kafka.ErrInvalidPartitions}
+		}
+		if topic.ReplicationFactor <= 0 || int(topic.ReplicationFactor) > len(c.Brokers) {
+			return &kafka.Error{Code: kafka.ErrInvalidReplicationFactor}
+		}
+		// Replicas are spread round-robin like by Kafka without racks
+		for partition := int32(0); partition < topic.Partitions; partition++ {
+			for replica := int32(0); replica < int32(topic.ReplicationFactor); replica++ {
+				broker := c.Brokers[int(partition+replica)%len(c.Brokers)]
+				assignment[partition] = append(assignment[partition], broker.ID)
+			}
+		}
+	}
+	c.Topics[topic.Name] = assignment
+	if len(topic.Configs) > 0 {
+		c.Configs[kafka.ConfigResource{Type: kafka.ResourceTypeTopic, Name: topic.Name}] = copyConfigs(topic.Configs)
+	}
+	return nil
+}
+
+func (c *Client) DeleteTopic(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	if _, ok := c.Topics[name]; !ok {
+		return &kafka.Error{Code: kafka.ErrUnknownTopicOrPartition}
+	}
+	delete(c.Topics, name)
+	delete(c.Configs, kafka.ConfigResource{Type: kafka.ResourceTypeTopic, Name: name})
+	delete(c.Reassignments, name)
+	return nil
+}
+
+// DescribeConfigs returns configs set on resource, defaults of Kafka are not known
+func (c *Client) DescribeConfigs(resource kafka.ConfigResource) ([]kafka.ConfigEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if err := c.checkResource(resource); err != nil {
+		return nil, err
+	}
+
+	configs := c.Configs[resource]
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]kafka.ConfigEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, kafka.ConfigEntry{Name: name, Value: configs[name]})
+	}
+	return entries, nil
+}
+
+func (c *Client) AlterConfigs(resource kafka.ConfigResource, configs map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	if err := c.checkResource(resource); err != nil {
+		return err
+	}
+	c.Configs[resource] = copyConfigs(configs)
+	return nil
+}
+
+func (c *Client) DescribeACLs(filter kafka.ACL) ([]kafka.ACL, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	acls := []kafka.ACL{}
+	for _, acl := range c.ACLs {
+		if filter.Matches(acl) {
+			acls = append(acls, acl)
+		}
+	}
+	return acls, nil
+}
+
+func (c *Client) CreateACLs(acls []kafka.ACL) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	for _, acl := range acls {
+		exists := false
+		for _, existing := range c.ACLs {
+			exists = exists || existing == acl
+		}
+		if !exists {
+			c.ACLs = append(c.ACLs, acl)
+		}
+	}
+	return nil
+}
+
+func (c *Client) DeleteACLs(filter kafka.ACL) ([]kafka.ACL, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	deleted := []kafka.ACL{}
+	kept := []kafka.ACL{}
+	for _, acl := range c.ACLs {
+		if filter.Matches(acl) {
+			deleted = append(deleted, acl)
+		} else {
+			kept = append(kept, acl)
+		}
+	}
+	c.ACLs = kept
+	return deleted, nil
+}
+
+// AlterPartitionReassignments records reassignments, they are finished by CompleteReassignments
+func (c *Client) AlterPartitionReassignments(reassignments kafka.Reassignments) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	for topic, partitions := range reassignments {
+		for partition, replicas := range partitions {
+			if _, ok := c.Topics[topic][partition]; !ok {
+				return &kafka.Error{Code: kafka.ErrUnknownTopicOrPartition}
+			}
+			if replicas == nil {
+				if _, ok := c.Reassignments[topic][partition]; !ok {
+					return &kafka.Error{Code: kafka.ErrNoReassignmentInProgress}
+				}
+				delete(c.Reassignments[topic], partition)
+				continue
+			}
+			if c.Reassignments[topic] == nil {
+				c.Reassignments[topic] = map[int32][]int32{}
+			}
+			c.Reassignments[topic][partition] = append([]int32{}, replicas...)
+		}
+		if len(c.Reassignments[topic]) == 0 {
+			delete(c.Reassignments, topic)
+		}
+	}
+	return nil
+}
+
+func (c *Client) ListPartitionReassignments() (kafka.Reassignments, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	reassignments := kafka.Reassignments{}
+	for topic, partitions := range c.Reassignments {
+		reassignments[topic] = map[int32][]int32{}
+		for partition, replicas := range partitions {
+			reassignments[topic][partition] = append([]int32{}, replicas...)
+		}
+	}
+	return reassignments, nil
+}
+
+// CompleteReassignments moves partitions to their target replicas
+func (c *Client) CompleteReassignments() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, partitions := range c.Reassignments {
+		for partition, replicas := range partitions {
+			c.Topics[topic][partition] = replicas
+		}
+	}
+	c.Reassignments = kafka.Reassignments{}
+}
+
+// checkResource returns error of unknown topic
+func (c *Client) checkResource(resource kafka.ConfigResource) error {
+	if resource.Type != kafka.ResourceTypeTopic {
+		return nil
+	}
+	if _, ok := c.Topics[resource.Name]; !ok {
+		return &kafka.Error{Code: kafka.ErrUnknownTopicOrPartition}
+	}
+	return nil
+}
+
+func (c *Client) isLive(id int32) bool {
+	for _, broker := range c.Brokers {
+		if broker.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) topicNames() []string {
+	names := make([]string, 0, len(c.Topics))
+	for name := range c.Topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func partitionIDs(partitions map[int32][]int32) []int32 {
+	ids := make([]int32, 0, len(partitions))
+	for id := range partitions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func copyConfigs(configs map[string]string) map[string]string {
+	copied := make(map[string]string, len(configs))
+	for name, value := range configs {
+		copied[name] = value
+	}
+	return copied
+}
@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"fmt"
+)
+
+const (
+	apiKeyDescribeConfigs     = 32
+	apiVersionDescribeConfigs = 0
+	apiKeyAlterConfigs        = 33
+	apiVersionAlterConfigs    = 0
+)
+
+// ResourceType is a type of resource of configs and ACLs
+type ResourceType int8
+
+// Resource types, broker of configs has the same code as cluster of ACLs
+const (
+	ResourceTypeAny     ResourceType = 1
+	ResourceTypeTopic   ResourceType = 2
+	ResourceTypeGroup   ResourceType = 3
+	ResourceTypeCluster ResourceType = 4
+	ResourceTypeBroker  ResourceType = 4
+)
+
+// ConfigResource is a topic or a broker, Name of broker is its ID
+type ConfigResource struct {
+	Type ResourceType
+	Name string
+}
+
+// ConfigEntry is a config of resource
+type ConfigEntry struct {
+	Name      string
+	Value     string
+	ReadOnly  bool
+	Default   bool
+	Sensitive bool
+}
+
+// DescribeConfigs returns all configs of resource, configs of broker have to be requested from that broker
+func (c *Conn) DescribeConfigs(resource ConfigResource) ([]ConfigEntry, error) {
+	request := &encoder{}
+	request.putInt32(1)
+	request.putInt8(int8(resource.Type))
+	request.putString(resource.Name)
+	// Null array requests all configs
+	request.putInt32(-1)
+
+	response, err := c.request(apiKeyDescribeConfigs, apiVersionDescribeConfigs, request.data)
+	if err != nil {
+		return nil, err
+	}
+	// Throttle time
+	response.getInt32()
+	var configs []ConfigEntry
+	var resourceErr error
+	for i := response.getArrayLength(); i > 0; i-- {
+		resourceErr = newError(response.getInt16(), response.getString())
+		response.getInt8()
+		response.getString()
+		for j := response.getArrayLength(); j > 0; j-- {
+			configs = append(configs, ConfigEntry{
+				Name:      response.getString(),
+				Value:     response.getString(),
+				ReadOnly:  response.getBool(),
+				Default:   response.getBool(),
+				Sensitive: response.getBool(),
+			})
+		}
+	}
+	if response.err != nil {
+		return nil, fmt.Errorf("cannot decode configs of %s: %v", resource.Name, response.err)
+	}
+	if resourceErr != nil {
+		return nil, resourceErr
+	}
+	return configs, nil
+}
+
+// AlterConfigs replaces configs of resource, configs which are not given are reset to default
+func (c *Conn) AlterConfigs(resource ConfigResource, configs map[string]string) error {
+	request := &encoder{}
+	request.putInt32(1)
+	request.putInt8(int8(resource.Type))
+	request.putString(resource.Name)
+	putConfigEntries(request, configs)
+	// Validate only
+	request.putBool(false)
+
+	response, err := c.request(apiKeyAlterConfigs, apiVersionAlterConfigs, request.data)
+	if err != nil {
+		return err
+	}
+	// Throttle time
+	response.getInt32()
+	var resourceErr error
+	for i := response.getArrayLength(); i > 0; i-- {
+		resourceErr = newError(response.getInt16(), response.getString())
+		response.getInt8()
+		response.getString()
+	}
+	if response.err != nil {
+		return fmt.Errorf("cannot decode response of %s: %v", resource.Name, response.err)
+	}
+	return resourceErr
+}
@@ -0,0 +1,319 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// maxResponseSize limits size of response read from broker
+	maxResponseSize = 64 * 1024 * 1024
+	clientID        = "lite-kafka-operator"
+)
+
+// Conn is a connection to single Kafka broker, it implements only requests needed by operator
+type Conn struct {
+	conn          net.Conn
+	timeout       time.Duration
+	correlationID int32
+	// versions are versions of APIs supported by broker
+	versions map[int16]versionRange
+}
+
+// Dial connects to Kafka broker and requests versions of APIs it supports, timeout is applied to every request
+func Dial(ctx context.Context, address string, timeout time.Duration) (*Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, timeout)
+}
+
+// newConn requests versions of APIs over conn, conn is closed when it fails
+func newConn(conn net.Conn, timeout time.Duration) (*Conn, error) {
+	c := &Conn{conn: conn, timeout: timeout}
+	versions, err := c.apiVersions()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.versions = versions
+	return c, nil
+}
+
+// Close closes connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// request sends request with header and returns body of response, version has to be supported by broker
+func (c *Conn) request(apiKey, apiVersion int16, body []byte) (*decoder, error) {
+	if err := c.checkVersion(apiKey, apiVersion); err != nil {
+		return nil, err
+	}
+	return c.roundTrip(apiKey, apiVersion, body, false)
+}
+
+// requestFlexible sends request of flexible version, headers of request and response have tagged fields
+func (c *Conn) requestFlexible(apiKey, apiVersion int16, body []byte) (*decoder, error) {
+	if err := c.checkVersion(apiKey, apiVersion); err != nil {
+		return nil, err
+	}
+	return c.roundTrip(apiKey, apiVersion, body, true)
+}
+
+func (c *Conn) roundTrip(apiKey, apiVersion int16, body []byte, flexible bool) (*decoder, error) {
+	c.correlationID++
+	header := &encoder{}
+	header.putInt16(apiKey)
+	header.putInt16(apiVersion)
+	header.putInt32(c.correlationID)
+	header.putString(clientID)
+	if flexible {
+		header.putTaggedFields()
+	}
+
+	message := &encoder{}
+	message.putInt32(int32(len(header.data) + len(body)))
+	message.data = append(message.data, header.data...)
+	message.data = append(message.data, body...)
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(message.data); err != nil {
+		return nil, err
+	}
+
+	sizeData := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, sizeData); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(sizeData)
+	if size < 4 || size > maxResponseSize {
+		return nil, fmt.Errorf("invalid size of response: %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return nil, err
+	}
+
+	response := &decoder{data: data}
+	if correlationID := response.getInt32(); correlationID != c.correlationID {
+		return nil, fmt.Errorf("unexpected correlation id of response: %d", correlationID)
+	}
+	if flexible {
+		response.skipTaggedFields()
+	}
+	return response, nil
+}
+
+// encoder writes primitive types of Kafka protocol
+type encoder struct {
+	data []byte
+}
+
+func (e *encoder) putInt8(value int8) {
+	e.data = append(e.data, byte(value))
+}
+
+func (e *encoder) putBool(value bool) {
+	if value {
+		e.putInt8(1)
+	} else {
+		e.putInt8(0)
+	}
+}
+
+func (e *encoder) putInt16(value int16) {
+	e.data = append(e.data, byte(value>>8), byte(value))
+}
+
+func (e *encoder) putInt32(value int32) {
+	e.data = append(e.data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+func (e *encoder) putString(value string) {
+	e.putInt16(int16(len(value)))
+	e.data = append(e.data, value...)
+}
+
+// putNullableString writes empty string as null
+func (e *encoder) putNullableString(value string) {
+	if len(value) == 0 {
+		e.putInt16(-1)
+		return
+	}
+	e.putString(value)
+}
+
+func (e *encoder) putInt32Array(values []int32) {
+	e.putInt32(int32(len(values)))
+	for _, value := range values {
+		e.putInt32(value)
+	}
+}
+
+func (e *encoder) putUvarint(value uint64) {
+	e.data = append(e.data, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutUvarint(e.data[len(e.data)-binary.MaxVarintLen64:], value)
+	e.data = e.data[:len(e.data)-binary.MaxVarintLen64+n]
+}
+
+// putCompactArrayLength writes length of array in flexible version, -1 is null array
+func (e *encoder) putCompactArrayLength(length int) {
+	e.putUvarint(uint64(length + 1))
+}
+
+func (e *encoder) putCompactString(value string) {
+	e.putCompactArrayLength(len(value))
+	e.data = append(e.data, value...)
+}
+
+// putCompactInt32Array writes nil slice as null array
+func (e *encoder) putCompactInt32Array(values []int32) {
+	if values == nil {
+		e.putCompactArrayLength(-1)
+		return
+	}
+	e.putCompactArrayLength(len(values))
+	for _, value := range values {
+		e.putInt32(value)
+	}
+}
+
+// putTaggedFields writes empty tagged fields of flexible version
+func (e *encoder) putTaggedFields() {
+	e.putUvarint(0)
+}
+
+// decoder reads primitive types of Kafka protocol, first error stops decoding
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(size int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if size < 0 || len(d.data) < size {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	value := d.data[:size]
+	d.data = d.data[size:]
+	return value
+}
+
+func (d *decoder) getBool() bool {
+	value := d.next(1)
+	return value != nil && value[0] != 0
+}
+
+func (d *decoder) getInt8() int8 {
+	value := d.next(1)
+	if value == nil {
+		return 0
+	}
+	return int8(value[0])
+}
+
+func (d *decoder) getInt16() int16 {
+	value := d.next(2)
+	if value == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(value))
+}
+
+func (d *decoder) getInt32() int32 {
+	value := d.next(4)
+	if value == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(value))
+}
+
+// getString reads string, null string is returned as empty one
+func (d *decoder) getString() string {
+	size := d.getInt16()
+	if size < 0 {
+		return ""
+	}
+	return string(d.next(int(size)))
+}
+
+// getArrayLength reads length of array, null array has no items
+func (d *decoder) getArrayLength() int {
+	length := d.getInt32()
+	if length < 0 {
+		return 0
+	}
+	// Every item has at least one byte
+	if int(length) > len(d.data) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(length)
+}
+
+func (d *decoder) getInt32Array() []int32 {
+	values := []int32{}
+	for i := d.getArrayLength(); i > 0; i-- {
+		values = append(values, d.getInt32())
+	}
+	return values
+}
+
+func (d *decoder) getUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
+
+// getCompactArrayLength reads length of array or string in flexible version, null has no items
+func (d *decoder) getCompactArrayLength() int {
+	length := d.getUvarint()
+	if length == 0 {
+		return 0
+	}
+	if length-1 > uint64(len(d.data)) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(length - 1)
+}
+
+// getCompactString reads string in flexible version, null string is returned as empty one
+func (d *decoder) getCompactString() string {
+	return string(d.next(d.getCompactArrayLength()))
+}
+
+func (d *decoder) getCompactInt32Array() []int32 {
+	values := []int32{}
+	for i := d.getCompactArrayLength(); i > 0; i-- {
+		values = append(values, d.getInt32())
+	}
+	return values
+}
+
+// skipTaggedFields skips tagged fields of flexible version, operator does not use any
+func (d *decoder) skipTaggedFields() {
+	for i := d.getUvarint(); i > 0 && d.err == nil; i-- {
+		d.getUvarint()
+		d.next(int(d.getUvarint()))
+	}
+}
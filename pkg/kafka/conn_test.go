@@ -0,0 +1,462 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testTimeout = 10 * time.Second
+
+// Fixtures below are bodies of requests and responses without headers, encoded field by field
+// as described by Kafka protocol guide, strings are prefixed by their length
+
+// apiVersionsKafka24 lists versions of APIs used by operator supported by Kafka 2.4
+const apiVersionsKafka24 = "\x00\x00" + // error code
+	"\x00\x00\x00\x0b" + // api keys
+	"\x00\x03\x00\x00\x00\x08" + // Metadata 0-8
+	"\x00\x12\x00\x00\x00\x03" + // ApiVersions 0-3
+	"\x00\x13\x00\x00\x00\x05" + // CreateTopics 0-5
+	"\x00\x14\x00\x00\x00\x04" + // DeleteTopics 0-4
+	"\x00\x1d\x00\x00\x00\x01" + // DescribeAcls 0-1
+	"\x00\x1e\x00\x00\x00\x01" + // CreateAcls 0-1
+	"\x00\x1f\x00\x00\x00\x01" + // DeleteAcls 0-1
+	"\x00\x20\x00\x00\x00\x02" + // DescribeConfigs 0-2
+	"\x00\x21\x00\x00\x00\x01" + // AlterConfigs 0-1
+	"\x00\x2d\x00\x00\x00\x00" + // AlterPartitionReassignments 0
+	"\x00\x2e\x00\x00\x00\x00" // ListPartitionReassignments 0
+
+// apiVersionsKafka40 lists versions of Metadata and ApiVersions of Kafka 4.0, which removed Metadata below version 4
+const apiVersionsKafka40 = "\x00\x00" + // error code
+	"\x00\x00\x00\x02" + // api keys
+	"\x00\x03\x00\x04\x00\x0c" + // Metadata 4-12
+	"\x00\x12\x00\x00\x00\x04" // ApiVersions 0-4
+
+const metadataRequest = "\xff\xff\xff\xff" // null topics
+
+const metadataResponse = "\x00\x00\x00\x02" + // brokers
+	"\x00\x00\x00\x00" + "\x00\x07kafka-0" + "\x00\x00\x23\x84" + "\x00\x06zone-a" +
+	"\x00\x00\x00\x01" + "\x00\x07kafka-1" + "\x00\x00\x23\x84" + "\xff\xff" + // null rack
+	"\x00\x00\x00\x01" + // controller id
+	"\x00\x00\x00\x01" + // topics
+	"\x00\x00" + "\x00\x06events" + "\x00" + // error code, name, internal
+	"\x00\x00\x00\x02" + // partitions
+	"\x00\x00" + "\x00\x00\x00\x00" + "\x00\x00\x00\x00" + // error code, id, leader
+	"\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x01" + // replicas
+	"\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x01" + // isr
+	"\x00\x00" + "\x00\x00\x00\x01" + "\xff\xff\xff\xff" + // offline partition
+	"\x00\x00\x00\x02\x00\x00\x00\x01\x00\x00\x00\x00" + // replicas
+	"\x00\x00\x00\x00" // isr
+
+// exchange is a request expected by fake broker and a response it sends back
+type exchange struct {
+	apiKey     int16
+	apiVersion int16
+	flexible   bool
+	request    string
+	response   string
+	// correlationID of response replaces correlation ID of request when it is set
+	correlationID int32
+}
+
+// newTestConn returns connection to fake broker, which replies to ApiVersions by versions and then
+// serves exchanges in order, returned function closes connection and waits for broker
+func newTestConn(t *testing.T, versions string, exchanges ...exchange) (*Conn, func()) {
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		exchanges = append([]exchange{{apiKey: apiKeyAPIVersions, response: versions}}, exchanges...)
+		for _, e := range exchanges {
+			if !serveExchange(t, server, e) {
+				return
+			}
+		}
+	}()
+
+	conn, err := newConn(client, testTimeout)
+	if err != nil {
+		<-done
+		t.Fatalf("cannot request API versions: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		<-done
+	}
+}
+
+// serveExchange reads request and checks its header and body, it returns false when connection is closed
+func serveExchange(t *testing.T, server net.Conn, e exchange) bool {
+	sizeData := make([]byte, 4)
+	if _, err := io.ReadFull(server, sizeData); err != nil {
+		if err != io.EOF {
+			t.Errorf("cannot read request: %v", err)
+		}
+		return false
+	}
+	data := make([]byte, binary.BigEndian.Uint32(sizeData))
+	if _, err := io.ReadFull(server, data); err != nil {
+		t.Errorf("cannot read request: %v", err)
+		return false
+	}
+
+	request := &decoder{data: data}
+	apiKey, apiVersion, correlationID := request.getInt16(), request.getInt16(), request.getInt32()
+	if id := request.getString(); id != clientID {
+		t.Errorf("expected client id %s, got %s", clientID, id)
+	}
+	if e.flexible {
+		request.skipTaggedFields()
+	}
+	if apiKey != e.apiKey || apiVersion != e.apiVersion {
+		t.Errorf("expected request %d version %d, got %d version %d", e.apiKey, e.apiVersion, apiKey, apiVersion)
+	}
+	if body := string(request.data); request.err != nil || body != e.request {
+		t.Errorf("request %d differs\nexpected: % x\ngot:      % x", apiKey, e.request, body)
+	}
+
+	response := &encoder{}
+	if e.correlationID != 0 {
+		correlationID = e.correlationID
+	}
+	response.putInt32(correlationID)
+	if e.flexible {
+		response.putTaggedFields()
+	}
+	response.data = append(response.data, e.response...)
+	message := &encoder{}
+	message.putInt32(int32(len(response.data)))
+	message.data = append(message.data, response.data...)
+	if _, err := server.Write(message.data); err != nil {
+		t.Errorf("cannot write response: %v", err)
+		return false
+	}
+	return true
+}
+
+func TestMetadata(t *testing.T) {
+	conn, closeConn := newTestConn(t, apiVersionsKafka24, exchange{
+		apiKey:     apiKeyMetadata,
+		apiVersion: apiVersionMetadata,
+		request:    metadataRequest,
+		response:   metadataResponse,
+	})
+	defer closeConn()
+
+	metadata, err := conn.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Metadata{
+		Brokers: []Broker{
+			{ID: 0, Host: "kafka-0", Port: 9092, Rack: "zone-a"},
+			{ID: 1, Host: "kafka-1", Port: 9092},
+		},
+		ControllerID: 1,
+		Topics: []Topic{{
+			Name: "events",
+			Partitions: []Partition{
+				{ID: 0, Leader: 0, Replicas: []int32{0, 1}, ISR: []int32{0, 1}},
+				{ID: 1, Leader: -1, Replicas: []int32{1, 0}, ISR: []int32{}},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("expected metadata %+v, got %+v", expected, metadata)
+	}
+}
+
+func TestMetadataTruncated(t *testing.T) {
+	// Response ends in the middle of partitions of topic
+	conn, closeConn := newTestConn(t, apiVersionsKafka24, exchange{
+		apiKey:     apiKeyMetadata,
+		apiVersion: apiVersionMetadata,
+		request:    metadataRequest,
+		response:   metadataResponse[:len(metadataResponse)-10],
+	})
+	defer closeConn()
+
+	if metadata, err := conn.Metadata(); err == nil {
+		t.Errorf("expected error of truncated response, got %+v", metadata)
+	}
+}
+
+func TestUnexpectedCorrelationID(t *testing.T) {
+	conn, closeConn := newTestConn(t, apiVersionsKafka24, exchange{
+		apiKey:        apiKeyMetadata,
+		apiVersion:    apiVersionMetadata,
+		request:       metadataRequest,
+		response:      metadataResponse,
+		correlationID: 7,
+	})
+	defer closeConn()
+
+	if _, err := conn.Metadata(); err == nil {
+		t.Error("expected error of response to other request")
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	conn, closeConn := newTestConn(t, apiVersionsKafka40)
+	defer closeConn()
+
+	// Requests are rejected before they are sent, fake broker fails on any of them
+	if _, err := conn.Metadata(); !HasErrorCode(err, ErrUnsupportedVersion) {
+		t.Errorf("expected error %s of Metadata, got %v", ErrUnsupportedVersion, err)
+	}
+	if _, err := conn.ListPartitionReassignments(); !HasErrorCode(err, ErrUnsupportedVersion) {
+		t.Errorf("expected error %s of ListPartitionReassignments, got %v", ErrUnsupportedVersion, err)
+	}
+}
+
+func TestAPIVersionsError(t *testing.T) {
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		serveExchange(t, server, exchange{apiKey: apiKeyAPIVersions, response: "\x00\x23\x00\x00\x00\x00"})
+	}()
+	defer func() { <-done }()
+
+	if _, err := newConn(client, testTimeout); !HasErrorCode(err, ErrUnsupportedVersion) {
+		t.Errorf("expected error %s, got %v", ErrUnsupportedVersion, err)
+	}
+}
+
+func TestConfigs(t *testing.T) {
+	conn, closeConn := newTestConn(t, apiVersionsKafka24,
+		exchange{
+			apiKey:     apiKeyDescribeConfigs,
+			apiVersion: apiVersionDescribeConfigs,
+			request: "\x00\x00\x00\x01" + "\x04" + "\x00\x010" + // broker 0
+				"\xff\xff\xff\xff", // null config names
+			response: "\x00\x00\x00\x00" + // throttle time
+				"\x00\x00\x00\x01" + "\x00\x00" + "\xff\xff" + "\x04" + "\x00\x010" +
+				"\x00\x00\x00\x02" + // configs
+				"\x00\x13log.retention.hours" + "\x00\x03168" + "\x00" + "\x01" + "\x00" +
+				"\x00\x15ssl.keystore.password" + "\xff\xff" + "\x00" + "\x00" + "\x01",
+		},
+		exchange{
+			apiKey:     apiKeyAlterConfigs,
+			apiVersion: apiVersionAlterConfigs,
+			request: "\x00\x00\x00\x01" + "\x02" + "\x00\x06events" + // topic events
+				"\x00\x00\x00\x01" + "\x00\x0cretention.ms" + "\x00\x041000" +
+				"\x00", // validate only
+			response: "\x00\x00\x00\x00" + // throttle time
+				"\x00\x00\x00\x01" + "\x00\x28" + "\x00\x0dInvalid value" + "\x02" + "\x00\x06events",
+		},
+	)
+	defer closeConn()
+
+	configs, err := conn.DescribeConfigs(ConfigResource{Type: ResourceTypeBroker, Name: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ConfigEntry{
+		{Name: "log.retention.hours", Value: "168", Default: true},
+		{Name: "ssl.keystore.password", Sensitive: true},
+	}
+	if !reflect.DeepEqual(configs, expected) {
+		t.Errorf("expected configs %+v, got %+v", expected, configs)
+	}
+
+	err = conn.AlterConfigs(ConfigResource{Type: ResourceTypeTopic, Name: "events"}, map[string]string{"retention.ms": "1000"})
+	if !reflect.DeepEqual(err, &Error{Code: ErrInvalidConfig, Message: "Invalid value"}) {
+		t.Errorf("expected error %s, got %v", ErrInvalidConfig, err)
+	}
+}
+
+func TestTopics(t *testing.T) {
+	conn, closeConn := newTestConn(t, apiVersionsKafka24,
+		exchange{
+			apiKey:     apiKeyCreateTopics,
+			apiVersion: apiVersionCreateTopics,
+			request: "\x00\x00\x00\x01" + "\x00\x06events" +
+				"\xff\xff\xff\xff" + "\xff\xff" + // partitions and replication factor of assignment
+				"\x00\x00\x00\x02" +
+				"\x00\x00\x00\x00" + "\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x01" +
+				"\x00\x00\x00\x01" + "\x00\x00\x00\x02\x00\x00\x00\x01\x00\x00\x00\x00" +
+				"\x00\x00\x00\x01" + "\x00\x0ecleanup.policy" + "\x00\x07compact" +
+				"\x00\x00\x27\x10", // timeout
+			response: "\x00\x00\x00\x01" + "\x00\x06events" + "\x00\x24",
+		},
+		exchange{
+			apiKey:     apiKeyDeleteTopics,
+			apiVersion: apiVersionDeleteTopics,
+			request:    "\x00\x00\x00\x01" + "\x00\x06events" + "\x00\x00\x27\x10",
+			response:   "\x00\x00\x00\x01" + "\x00\x06events" + "\x00\x00",
+		},
+	)
+	defer closeConn()
+
+	err := conn.CreateTopic(TopicSpec{
+		Name:              "events",
+		Partitions:        -1,
+		ReplicationFactor: -1,
+		ReplicaAssignment: map[int32][]int32{0: {0, 1}, 1: {1, 0}},
+		Configs:           map[string]string{"cleanup.policy": "compact"},
+	})
+	if !HasErrorCode(err, ErrTopicAlreadyExists) {
+		t.Errorf("expected error %s, got %v", ErrTopicAlreadyExists, err)
+	}
+	if err := conn.DeleteTopic("events"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestACLs(t *testing.T) {
+	acl := ACL{
+		ResourceType: ResourceTypeTopic,
+		ResourceName: "events",
+		Principal:    "User:alice",
+		Host:         "*",
+		Operation:    ACLOperationRead,
+		Permission:   ACLPermissionAllow,
+	}
+	conn, closeConn := newTestConn(t, apiVersionsKafka24,
+		exchange{
+			apiKey:     apiKeyDescribeACLs,
+			apiVersion: apiVersionDescribeACLs,
+			request:    "\x02" + "\x00\x06events" + "\xff\xff" + "\xff\xff" + "\x01" + "\x01",
+			response: "\x00\x00\x00\x00" + "\x00\x00" + "\xff\xff" + // throttle time, error
+				"\x00\x00\x00\x01" + "\x02" + "\x00\x06events" +
+				"\x00\x00\x00\x01" + "\x00\x0aUser:alice" + "\x00\x01*" + "\x03" + "\x03",
+		},
+		exchange{
+			apiKey:     apiKeyCreateACLs,
+			apiVersion: apiVersionCreateACLs,
+			request: "\x00\x00\x00\x01" + "\x02" + "\x00\x06events" +
+				"\x00\x0aUser:alice" + "\x00\x01*" + "\x03" + "\x03",
+			response: "\x00\x00\x00\x00" +
+				"\x00\x00\x00\x01" + "\x00\x36" + "\x00\x29No Authorizer is configured on the broker",
+		},
+		exchange{
+			apiKey:     apiKeyDeleteACLs,
+			apiVersion: apiVersionDeleteACLs,
+			request: "\x00\x00\x00\x01" +
+				"\x02" + "\x00\x06events" + "\x00\x0aUser:alice" + "\xff\xff" + "\x01" + "\x01",
+			response: "\x00\x00\x00\x00" +
+				"\x00\x00\x00\x01" + "\x00\x00" + "\xff\xff" + // filter result
+				"\x00\x00\x00\x01" + "\x00\x00" + "\xff\xff" + // matching ACL
+				"\x02" + "\x00\x06events" + "\x00\x0aUser:alice" + "\x00\x01*" + "\x03" + "\x03",
+		},
+	)
+	defer closeConn()
+
+	acls, err := conn.DescribeACLs(ACL{ResourceType: ResourceTypeTopic, ResourceName: "events",
+		Operation: ACLOperationAny, Permission: ACLPermissionAny})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(acls, []ACL{acl}) {
+		t.Errorf("expected ACLs %+v, got %+v", []ACL{acl}, acls)
+	}
+
+	if err := conn.CreateACLs([]ACL{acl}); !HasErrorCode(err, ErrSecurityDisabled) {
+		t.Errorf("expected error %s, got %v", ErrSecurityDisabled, err)
+	}
+
+	deleted, err := conn.DeleteACLs(ACL{ResourceType: ResourceTypeTopic, ResourceName: "events",
+		Principal: "User:alice", Operation: ACLOperationAny, Permission: ACLPermissionAny})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []ACL{acl}) {
+		t.Errorf("expected deleted ACLs %+v, got %+v", []ACL{acl}, deleted)
+	}
+}
+
+func TestPartitionReassignments(t *testing.T) {
+	conn, closeConn := newTestConn(t, apiVersionsKafka24,
+		exchange{
+			apiKey:     apiKeyAlterPartitionReassignments,
+			apiVersion: apiVersionAlterPartitionReassignments,
+			flexible:   true,
+			request: "\x00\x00\x27\x10" + // timeout
+				"\x02" + "\x07events" + "\x03" + // compact lengths are incremented by one
+				"\x00\x00\x00\x00" + "\x03\x00\x00\x00\x01\x00\x00\x00\x02" + "\x00" +
+				"\x00\x00\x00\x01" + "\x00" + "\x00" + // null replicas cancel reassignment
+				"\x00" + "\x00", // tagged fields of topic and request
+			response: "\x00\x00\x00\x00" + "\x00\x00" + "\x00" + // throttle time, error
+				"\x02" + "\x07events" + "\x03" +
+				"\x00\x00\x00\x00" + "\x00\x00" + "\x00" + "\x00" +
+				"\x00\x00\x00\x01" + "\x00\x55" + "\x00" + "\x00" +
+				"\x00" + "\x00",
+		},
+		exchange{
+			apiKey:     apiKeyListPartitionReassignments,
+			apiVersion: apiVersionListPartitionReassignments,
+			flexible:   true,
+			request:    "\x00\x00\x27\x10" + "\x00" + "\x00", // timeout, null topics
+			response: "\x00\x00\x00\x00" + "\x00\x00" + "\x00" +
+				"\x02" + "\x07events" + "\x02" +
+				"\x00\x00\x00\x00" + "\x04\x00\x00\x00\x01\x00\x00\x00\x02\x00\x00\x00\x00" + // replicas
+				"\x02\x00\x00\x00\x02" + "\x02\x00\x00\x00\x00" + "\x00" + // adding and removing replicas
+				"\x00" +
+				"\x01" + "\x00" + "\x02\xab\xcd", // unknown tagged field is skipped
+		},
+	)
+	defer closeConn()
+
+	err := conn.AlterPartitionReassignments(Reassignments{"events": {0: {1, 2}, 1: nil}})
+	if err == nil || err.Error() != "cannot reassign partition events-1: NO_REASSIGNMENT_IN_PROGRESS" {
+		t.Errorf("expected error %s of partition 1, got %v", ErrNoReassignmentInProgress, err)
+	}
+
+	reassignments, err := conn.ListPartitionReassignments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Reassignments{"events": {0: {1, 2, 0}}}
+	if !reflect.DeepEqual(reassignments, expected) {
+		t.Errorf("expected reassignments %v, got %v", expected, reassignments)
+	}
+}
+
+func TestCompactEncoding(t *testing.T) {
+	e := &encoder{}
+	e.putUvarint(300)
+	e.putCompactString("events")
+	e.putCompactString("")
+	e.putCompactInt32Array(nil)
+	e.putCompactInt32Array([]int32{1, 2})
+	e.putTaggedFields()
+
+	expected := "\xac\x02" + "\x07events" + "\x01" + "\x00" + "\x03\x00\x00\x00\x01\x00\x00\x00\x02" + "\x00"
+	if string(e.data) != expected {
+		t.Fatalf("expected % x, got % x", expected, e.data)
+	}
+
+	d := &decoder{data: e.data}
+	if value := d.getUvarint(); value != 300 {
+		t.Errorf("expected 300, got %d", value)
+	}
+	if value := d.getCompactString(); value != "events" {
+		t.Errorf("expected events, got %s", value)
+	}
+	if value := d.getCompactString(); value != "" {
+		t.Errorf("expected empty string, got %s", value)
+	}
+	if values := d.getCompactInt32Array(); len(values) != 0 {
+		t.Errorf("expected no values of null array, got %v", values)
+	}
+	if values := d.getCompactInt32Array(); !reflect.DeepEqual(values, []int32{1, 2}) {
+		t.Errorf("expected [1 2], got %v", values)
+	}
+	d.skipTaggedFields()
+	if d.err != nil || len(d.data) != 0 {
+		t.Errorf("expected whole data decoded, got error %v and % x left", d.err, d.data)
+	}
+
+	// Length of array exceeds data
+	d = &decoder{data: []byte("\x05\x00\x00\x00\x01")}
+	d.getCompactInt32Array()
+	if d.err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, d.err)
+	}
+}
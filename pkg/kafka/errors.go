@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"fmt"
+)
+
+// ErrorCode is an error code returned by broker
+type ErrorCode int16
+
+// Error codes handled by operator
+const (
+	ErrNone                     ErrorCode = 0
+	ErrUnknownTopicOrPartition  ErrorCode = 3
+	ErrUnsupportedVersion       ErrorCode = 35
+	ErrTopicAlreadyExists       ErrorCode = 36
+	ErrInvalidPartitions        ErrorCode = 37
+	ErrInvalidReplicationFactor ErrorCode = 38
+	ErrInvalidConfig            ErrorCode = 40
+	ErrNotController            ErrorCode = 41
+	ErrSecurityDisabled         ErrorCode = 54
+	ErrReassignmentInProgress   ErrorCode = 60
+	ErrNoReassignmentInProgress ErrorCode = 85
+)
+
+var errorNames = map[ErrorCode]string{
+	ErrUnknownTopicOrPartition:  "UNKNOWN_TOPIC_OR_PARTITION",
+	ErrUnsupportedVersion:       "UNSUPPORTED_VERSION",
+	ErrTopicAlreadyExists:       "TOPIC_ALREADY_EXISTS",
+	ErrInvalidPartitions:        "INVALID_PARTITIONS",
+	ErrInvalidReplicationFactor: "INVALID_REPLICATION_FACTOR",
+	ErrInvalidConfig:            "INVALID_CONFIG",
+	ErrNotController:            "NOT_CONTROLLER",
+	ErrSecurityDisabled:         "SECURITY_DISABLED",
+	ErrReassignmentInProgress:   "REASSIGNMENT_IN_PROGRESS",
+	ErrNoReassignmentInProgress: "NO_REASSIGNMENT_IN_PROGRESS",
+}
+
+// String returns name of error code used by Kafka
+func (c ErrorCode) String() string {
+	if name, ok := errorNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("error code %d", int16(c))
+}
+
+// Error is an error returned by broker for request or its part
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return e.Code.String()
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// newError returns nil when code is not an error
+func newError(code int16, message string) error {
+	if ErrorCode(code) == ErrNone {
+		return nil
+	}
+	return &Error{Code: ErrorCode(code), Message: message}
+}
+
+// HasErrorCode returns true when err is an error returned by broker with given code
+func HasErrorCode(err error, code ErrorCode) bool {
+	kafkaErr, ok := err.(*Error)
+	return ok && kafkaErr.Code == code
+}
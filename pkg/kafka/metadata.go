@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"fmt"
+)
+
+const (
+	apiKeyMetadata     = 3
+	apiVersionMetadata = 1
+)
+
+// Broker is a broker registered in cluster
+type Broker struct {
+	ID   int32
+	Host string
+	Port int32
+	Rack string
+}
+
+// Partition is a state of topic partition
+type Partition struct {
+	Error    int16
+	ID       int32
+	Leader   int32
+	Replicas []int32
+	ISR      []int32
+}
+
+// Topic is a state of topic and its partitions
+type Topic struct {
+	Error      int16
+	Name       string
+	Internal   bool
+	Partitions []Partition
+}
+
+// Metadata is a cluster state known by broker
+type Metadata struct {
+	Brokers      []Broker
+	ControllerID int32
+	Topics       []Topic
+}
+
+// Metadata returns brokers, controller and all topics known by broker
+func (c *Conn) Metadata() (*Metadata, error) {
+	request := &encoder{}
+	// Null array requests all topics
+	request.putInt32(-1)
+	response, err := c.request(apiKeyMetadata, apiVersionMetadata, request.data)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{}
+	for i := response.getArrayLength(); i > 0; i-- {
+		metadata.Brokers = append(metadata.Brokers, Broker{
+			ID:   response.getInt32(),
+			Host: response.getString(),
+			Port: response.getInt32(),
+			Rack: response.getString(),
+		})
+	}
+	metadata.ControllerID = response.getInt32()
+	for i := response.getArrayLength(); i > 0; i-- {
+		topic := Topic{
+			Error:    response.getInt16(),
+			Name:     response.getString(),
+			Internal: response.getBool(),
+		}
+		for j := response.getArrayLength(); j > 0; j-- {
+			topic.Partitions = append(topic.Partitions, Partition{
+				Error:    response.getInt16(),
+				ID:       response.getInt32(),
+				Leader:   response.getInt32(),
+				Replicas: response.getInt32Array(),
+				ISR:      response.getInt32Array(),
+			})
+		}
+		metadata.Topics = append(metadata.Topics, topic)
+	}
+	if response.err != nil {
+		return nil, fmt.Errorf("cannot decode metadata: %v", response.err)
+	}
+	return metadata, nil
+}
+
+// HasBroker returns true when broker is registered in cluster
+func (m *Metadata) HasBroker(id int32) bool {
+	for _, broker := range m.Brokers {
+		if broker.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOffline returns true when partition has no leader
+func (p *Partition) IsOffline() bool {
+	return p.Leader < 0
+}
+
+// IsUnderReplicated returns true when some replicas are not in sync
+func (p *Partition) IsUnderReplicated() bool {
+	return len(p.ISR) < len(p.Replicas)
+}
+
+// IsReplica returns true when broker is a replica of partition
+func (p *Partition) IsReplica(id int32) bool {
+	return contains(p.Replicas, id)
+}
+
+// IsInSync returns true when broker is in-sync replica of partition
+func (p *Partition) IsInSync(id int32) bool {
+	return contains(p.ISR, id)
+}
+
+func contains(values []int32, value int32) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
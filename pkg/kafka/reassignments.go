@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Reassignment requests use flexible versions only, they are supported since Kafka 2.4
+const (
+	apiKeyAlterPartitionReassignments     = 45
+	apiVersionAlterPartitionReassignments = 0
+	apiKeyListPartitionReassignments      = 46
+	apiVersionListPartitionReassignments  = 0
+)
+
+// Reassignments are target replicas of partitions by topic, nil replicas cancel reassignment of partition
+type Reassignments map[string]map[int32][]int32
+
+// AlterPartitionReassignments starts or cancels reassignments, request has to be sent to controller
+func (c *Conn) AlterPartitionReassignments(reassignments Reassignments) error {
+	request := &encoder{}
+	request.putInt32(int32(c.timeout.Nanoseconds() / 1e6))
+	topics := make([]string, 0, len(reassignments))
+	for topic := range reassignments {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	request.putCompactArrayLength(len(topics))
+	for _, topic := range topics {
+		request.putCompactString(topic)
+		partitions := make([]int32, 0, len(reassignments[topic]))
+		for partition := range reassignments[topic] {
+			partitions = append(partitions, partition)
+		}
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		request.putCompactArrayLength(len(partitions))
+		for _, partition := range partitions {
+			request.putInt32(partition)
+			request.putCompactInt32Array(reassignments[topic][partition])
+			request.putTaggedFields()
+		}
+		request.putTaggedFields()
+	}
+	request.putTaggedFields()
+
+	response, err := c.requestFlexible(apiKeyAlterPartitionReassignments, apiVersionAlterPartitionReassignments, request.data)
+	if err != nil {
+		return err
+	}
+	// Throttle time
+	response.getInt32()
+	requestErr := newError(response.getInt16(), response.getCompactString())
+	for i := response.getCompactArrayLength(); i > 0; i-- {
+		topic := response.getCompactString()
+		for j := response.getCompactArrayLength(); j > 0; j-- {
+			partition := response.getInt32()
+			if err := newError(response.getInt16(), response.getCompactString()); err != nil && requestErr == nil {
+				requestErr = fmt.Errorf("cannot reassign partition %s-%d: %v", topic, partition, err)
+			}
+			response.skipTaggedFields()
+		}
+		response.skipTaggedFields()
+	}
+	if response.err != nil {
+		return fmt.Errorf("cannot decode response of reassignments: %v", response.err)
+	}
+	return requestErr
+}
+
+// ListPartitionReassignments returns target replicas of partitions being reassigned
+func (c *Conn) ListPartitionReassignments() (Reassignments, error) {
+	request := &encoder{}
+	request.putInt32(int32(c.timeout.Nanoseconds() / 1e6))
+	// Null array requests all topics
+	request.putCompactArrayLength(-1)
+	request.putTaggedFields()
+
+	response, err := c.requestFlexible(apiKeyListPartitionReassignments, apiVersionListPartitionReassignments, request.data)
+	if err != nil {
+		return nil, err
+	}
+	// Throttle time
+	response.getInt32()
+	requestErr := newError(response.getInt16(), response.getCompactString())
+	reassignments := Reassignments{}
+	for i := response.getCompactArrayLength(); i > 0; i-- {
+		topic := response.getCompactString()
+		reassignments[topic] = map[int32][]int32{}
+		for j := response.getCompactArrayLength(); j > 0; j-- {
+			partition := response.getInt32()
+			reassignments[topic][partition] = response.getCompactInt32Array()
+			// Adding and removing replicas
+			response.getCompactInt32Array()
+			response.getCompactInt32Array()
+			response.skipTaggedFields()
+		}
+		response.skipTaggedFields()
+	}
+	if response.err != nil {
+		return nil, fmt.Errorf("cannot decode reassignments: %v", response.err)
+	}
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	return reassignments, nil
+}
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	apiKeyCreateTopics     = 19
+	apiVersionCreateTopics = 0
+	apiKeyDeleteTopics     = 20
+	apiVersionDeleteTopics = 0
+)
+
+// TopicSpec defines topic created by operator
+type TopicSpec struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int16
+	// ReplicaAssignment places replicas of partitions to brokers, Partitions and ReplicationFactor
+	// have to be -1 when it is set
+	ReplicaAssignment map[int32][]int32
+	Configs           map[string]string
+}
+
+// CreateTopic creates topic, request has to be sent to controller
+func (c *Conn) CreateTopic(topic TopicSpec) error {
+	request := &encoder{}
+	request.putInt32(1)
+	request.putString(topic.Name)
+	request.putInt32(topic.Partitions)
+	request.putInt16(topic.ReplicationFactor)
+	partitions := make([]int32, 0, len(topic.ReplicaAssignment))
+	for partition := range topic.ReplicaAssignment {
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	request.putInt32(int32(len(partitions)))
+	for _, partition := range partitions {
+		request.putInt32(partition)
+		request.putInt32Array(topic.ReplicaAssignment[partition])
+	}
+	putConfigEntries(request, topic.Configs)
+	request.putInt32(int32(c.timeout.Nanoseconds() / 1e6))
+
+	response, err := c.request(apiKeyCreateTopics, apiVersionCreateTopics, request.data)
+	if err != nil {
+		return err
+	}
+	return getTopicError(response, topic.Name)
+}
+
+// DeleteTopic deletes topic, request has to be sent to controller
+func (c *Conn) DeleteTopic(name string) error {
+	request := &encoder{}
+	request.putInt32(1)
+	request.putString(name)
+	request.putInt32(int32(c.timeout.Nanoseconds() / 1e6))
+
+	response, err := c.request(apiKeyDeleteTopics, apiVersionDeleteTopics, request.data)
+	if err != nil {
+		return err
+	}
+	return getTopicError(response, name)
+}
+
+// getTopicError reads error of topic from response of CreateTopics or DeleteTopics
+func getTopicError(response *decoder, name string) error {
+	for i := response.getArrayLength(); i > 0; i-- {
+		topic := response.getString()
+		code := response.getInt16()
+		if response.err == nil && topic == name {
+			return newError(code, "")
+		}
+	}
+	if response.err != nil {
+		return fmt.Errorf("cannot decode response of topic %s: %v", name, response.err)
+	}
+	return fmt.Errorf("response does not contain topic %s", name)
+}
+
+// putConfigEntries writes sorted config entries of CreateTopics and AlterConfigs
+func putConfigEntries(request *encoder, configs map[string]string) {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	request.putInt32(int32(len(names)))
+	for _, name := range names {
+		request.putString(name)
+		request.putString(configs[name])
+	}
+}
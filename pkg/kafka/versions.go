@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"fmt"
+)
+
+const (
+	apiKeyAPIVersions     = 18
+	apiVersionAPIVersions = 0
+)
+
+// versionRange is a range of versions of API supported by broker
+type versionRange struct {
+	min int16
+	max int16
+}
+
+// apiVersions returns versions of APIs supported by broker, it is supported since Kafka 0.10
+func (c *Conn) apiVersions() (map[int16]versionRange, error) {
+	response, err := c.roundTrip(apiKeyAPIVersions, apiVersionAPIVersions, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	requestErr := newError(response.getInt16(), "")
+	versions := map[int16]versionRange{}
+	for i := response.getArrayLength(); i > 0; i-- {
+		apiKey := response.getInt16()
+		versions[apiKey] = versionRange{min: response.getInt16(), max: response.getInt16()}
+	}
+	if response.err != nil {
+		return nil, fmt.Errorf("cannot decode API versions: %v", response.err)
+	}
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	return versions, nil
+}
+
+// checkVersion returns error with code UNSUPPORTED_VERSION when broker does not support version of API
+// used by operator, so request is not sent in format which broker cannot read
+func (c *Conn) checkVersion(apiKey, apiVersion int16) error {
+	versions, ok := c.versions[apiKey]
+	if !ok {
+		return &Error{Code: ErrUnsupportedVersion, Message: fmt.Sprintf("broker does not support API %d", apiKey)}
+	}
+	if apiVersion < versions.min || apiVersion > versions.max {
+		return &Error{
+			Code: ErrUnsupportedVersion,
+			Message: fmt.Sprintf("broker supports versions %d-%d of API %d, operator uses version %d",
+				versions.min, versions.max, apiKey, apiVersion),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package zookeeper
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const sessionTimeout = 10 * time.Second
+
+// ConnectionOptions defines security of connection to ZooKeeper
+type ConnectionOptions struct {
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+	// Username and Password are used for Digest authentication when set
+	Username string
+	Password string
+}
+
+// Conn is a session with ZooKeeper ensemble, it is implemented by zk.Conn
+type Conn interface {
+	Get(path string) ([]byte, *zk.Stat, error)
+	Exists(path string) (bool, *zk.Stat, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Close()
+}
+
+// Factory connects Client to ZooKeeper servers, it is injected into reconciler, so tests can replace session by fake one
+type Factory func(ctx context.Context, servers []string, options *ConnectionOptions) (*Client, error)
+
+// Client manages znodes of ZooKeeper ensemble
+type Client struct {
+	conn Conn
+	acl  []zk.ACL
+}
+
+// NewClientWithConn returns client using established session, znodes are created with open ACL
+func NewClientWithConn(conn Conn) *Client {
+	return &Client{conn: conn, acl: zk.WorldACL(zk.PermAll)}
+}
+
+// NewClient connects to ZooKeeper servers and waits until session is established
+func NewClient(ctx context.Context, servers []string, options *ConnectionOptions) (*Client, error) {
+	if options == nil {
+		options = &ConnectionOptions{}
+	}
+	conn, events, err := zk.Connect(servers, sessionTimeout, zk.WithLogInfo(false), zk.WithDialer(dialer(options.TLSConfig)))
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{conn: conn, acl: zk.WorldACL(zk.PermAll)}
+	if len(options.Username) > 0 {
+		if err = conn.AddAuth("digest", []byte(options.Username+":"+options.Password)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// Same ACL as brokers set with zookeeper.set.acl
+		client.acl = append(zk.DigestACL(zk.PermAll, options.Username, options.Password), zk.WorldACL(zk.PermRead)...)
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if event.State == zk.StateHasSession {
+				return client, nil
+			}
+			if event.State == zk.StateAuthFailed {
+				conn.Close()
+				return nil, fmt.Errorf("zookeeper authentication failed")
+			}
+		case <-ctx.Done():
+			conn.Close()
+			return nil, fmt.Errorf("cannot connect to zookeeper servers %s: %v", strings.Join(servers, ","), ctx.Err())
+		}
+	}
+}
+
+// Close closes session
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+// EnsurePath creates znode and all its parents if they do not exist
+func (c *Client) EnsurePath(path string) error {
+	current := ""
+	for _, node := range strings.Split(strings.Trim(path, "/"), "/") {
+		if len(node) == 0 {
+			continue
+		}
+		current += "/" + node
+		exists, _, err := c.conn.Exists(current)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = c.conn.Create(current, []byte{}, 0, c.acl)
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRecursive deletes znode with all its children, znode which does not exist is not an error
+func (c *Client) DeleteRecursive(path string) error {
+	children, _, err := c.conn.Children(path)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err = c.DeleteRecursive(strings.TrimSuffix(path, "/") + "/" + child); err != nil {
+			return err
+		}
+	}
+	err = c.conn.Delete(path, -1)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+// dialer returns dialer of plain connections or of TLS connections when config is set
+func dialer(config *tls.Config) zk.Dialer {
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		netDialer := &net.Dialer{Timeout: timeout}
+		if config == nil {
+			return netDialer.Dial(network, address)
+		}
+		return tls.DialWithDialer(netDialer, network, address, config)
+	}
+}
@@ -0,0 +1,129 @@
+// Package fake implements zookeeper.Conn by in-memory tree of znodes, so controller logic can be tested without ZooKeeper
+package fake
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Svimba/lite-kafka-operator/pkg/zookeeper"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Conn is an in-memory ensemble, its znodes can be set by tests before it is used
+type Conn struct {
+	mu sync.Mutex
+	// Err is returned by Factory when it is set
+	Err error
+	// Znodes are data by path, root znode always exists
+	Znodes map[string][]byte
+}
+
+// blank assignment to verify that Conn implements zookeeper.Conn
+var _ zookeeper.Conn = &Conn{}
+
+// NewConn returns ensemble with given znodes, their parents are created too
+func NewConn(znodes map[string]string) *Conn {
+	c := &Conn{Znodes: map[string][]byte{}}
+	for p, data := range znodes {
+		for parent := path.Dir(p); parent != "/"; parent = path.Dir(parent) {
+			if _, ok := c.Znodes[parent]; !ok {
+				c.Znodes[parent] = []byte{}
+			}
+		}
+		c.Znodes[p] = []byte(data)
+	}
+	return c
+}
+
+// Factory returns factory which connects always to this ensemble
+func (c *Conn) Factory() zookeeper.Factory {
+	return func(ctx context.Context, servers []string, options *zookeeper.ConnectionOptions) (*zookeeper.Client, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.Err != nil {
+			return nil, c.Err
+		}
+		return zookeeper.NewClientWithConn(c), nil
+	}
+}
+
+// Has returns true when znode exists
+func (c *Conn) Has(p string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exists(p)
+}
+
+// Close keeps znodes, ensemble can be used again
+func (c *Conn) Close() {
+}
+
+func (c *Conn) Get(p string) ([]byte, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.exists(p) {
+		return nil, nil, zk.ErrNoNode
+	}
+	return append([]byte{}, c.Znodes[p]...), &zk.Stat{}, nil
+}
+
+func (c *Conn) Exists(p string) (bool, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exists(p), &zk.Stat{}, nil
+}
+
+func (c *Conn) Children(p string) ([]string, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.exists(p) {
+		return nil, nil, zk.ErrNoNode
+	}
+	return c.children(p), &zk.Stat{}, nil
+}
+
+func (c *Conn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exists(p) {
+		return "", zk.ErrNodeExists
+	}
+	if !c.exists(path.Dir(p)) {
+		return "", zk.ErrNoNode
+	}
+	c.Znodes[p] = append([]byte{}, data...)
+	return p, nil
+}
+
+func (c *Conn) Delete(p string, version int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p == "/" || !c.exists(p) {
+		return zk.ErrNoNode
+	}
+	if len(c.children(p)) > 0 {
+		return zk.ErrNotEmpty
+	}
+	delete(c.Znodes, p)
+	return nil
+}
+
+func (c *Conn) exists(p string) bool {
+	_, ok := c.Znodes[p]
+	return ok || p == "/"
+}
+
+func (c *Conn) children(p string) []string {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	children := []string{}
+	for znode := range c.Znodes {
+		if strings.HasPrefix(znode, prefix) && !strings.Contains(znode[len(prefix):], "/") {
+			children = append(children, znode[len(prefix):])
+		}
+	}
+	sort.Strings(children)
+	return children
+}
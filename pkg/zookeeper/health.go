@@ -0,0 +1,287 @@
+package zookeeper
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server modes reported by srvr and mntr commands
+const (
+	ModeLeader     = "leader"
+	ModeFollower   = "follower"
+	ModeObserver   = "observer"
+	ModeStandalone = "standalone"
+)
+
+// maxResponseSize limits size of four letter word response
+const maxResponseSize = 64 * 1024
+
+// ServerStatus is a result of health check of a single ZooKeeper server
+type ServerStatus struct {
+	Address string
+	// Ok is true if server answered imok to ruok
+	Ok bool
+	// Serving is true if server is a member of quorum and serves requests
+	Serving bool
+	// Mode is one of leader, follower, observer or standalone
+	Mode string
+	// SyncedFollowers is reported by leader only, when mntr is allowed
+	SyncedFollowers int
+	Error           error
+}
+
+// EnsembleStatus is a result of health check of all ZooKeeper servers
+type EnsembleStatus struct {
+	Servers []ServerStatus
+}
+
+// Checker runs four letter word commands against ZooKeeper servers
+type Checker struct {
+	DialTimeout time.Duration
+	ReadTimeout time.Duration
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+}
+
+// NewChecker returns Checker with given timeouts
+func NewChecker(dialTimeout, readTimeout time.Duration) *Checker {
+	return &Checker{
+		DialTimeout: dialTimeout,
+		ReadTimeout: readTimeout,
+	}
+}
+
+// Check checks all servers concurrently, servers are in host:port form
+func (c *Checker) Check(ctx context.Context, servers []string) *EnsembleStatus {
+	status := &EnsembleStatus{Servers: make([]ServerStatus, len(servers))}
+	wg := sync.WaitGroup{}
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			status.Servers[i] = c.CheckServer(ctx, server)
+		}(i, server)
+	}
+	wg.Wait()
+	return status
+}
+
+// CheckServer checks a single server by ruok, srvr and for leader also mntr commands
+func (c *Checker) CheckServer(ctx context.Context, server string) ServerStatus {
+	status := ServerStatus{Address: server}
+
+	resp, err := c.FourLetterWord(ctx, server, "ruok")
+	if err != nil {
+		status.Error = err
+		return status
+	}
+	status.Ok = resp == "imok"
+
+	resp, err = c.FourLetterWord(ctx, server, "srvr")
+	if err != nil {
+		status.Error = err
+		return status
+	}
+	parseSrvr(resp, &status)
+
+	if status.Mode == ModeLeader {
+		// mntr does not have to be whitelisted, its result is optional
+		resp, err = c.FourLetterWord(ctx, server, "mntr")
+		if err == nil {
+			parseMntr(resp, &status)
+		}
+	}
+
+	return status
+}
+
+// FourLetterWord sends command to server and returns its response
+func (c *Checker) FourLetterWord(ctx context.Context, server, command string) (string, error) {
+	dialer := &net.Dialer{Timeout: c.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.ReadTimeout)
+	ctxDeadline, hasCtxDeadline := ctx.Deadline()
+	if hasCtxDeadline && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	if c.TLSConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfigForServer(c.TLSConfig, server))
+		defer tlsConn.Close()
+		if err = tlsConn.Handshake(); err != nil {
+			return "", err
+		}
+		conn = tlsConn
+	}
+
+	// Interrupt blocked read or write when context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err = io.WriteString(conn, command); err != nil {
+		return "", err
+	}
+	// Server closes connection after response is sent
+	data, err := ioutil.ReadAll(io.LimitReader(conn, maxResponseSize))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		// Connection can time out on deadline of context before context is done
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && hasCtxDeadline && !ctxDeadline.After(deadline) {
+			return "", context.DeadlineExceeded
+		}
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func parseSrvr(resp string, status *ServerStatus) {
+	if strings.Contains(resp, "not currently serving requests") {
+		status.Serving = false
+		return
+	}
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Mode:") {
+			status.Mode = strings.TrimSpace(strings.TrimPrefix(line, "Mode:"))
+			status.Serving = true
+			return
+		}
+	}
+	// srvr is not whitelisted, fall back to ruok result
+	status.Serving = status.Ok
+}
+
+func parseMntr(resp string, status *ServerStatus) {
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "zk_server_state":
+			status.Mode = fields[1]
+		case "zk_synced_followers":
+			if followers, err := strconv.Atoi(fields[1]); err == nil {
+				status.SyncedFollowers = followers
+			}
+		}
+	}
+}
+
+// Reachable returns number of servers which answered
+func (s *EnsembleStatus) Reachable() int {
+	reachable := 0
+	for _, server := range s.Servers {
+		if server.Error == nil {
+			reachable++
+		}
+	}
+	return reachable
+}
+
+// Serving returns number of servers which serve requests
+func (s *EnsembleStatus) Serving() int {
+	serving := 0
+	for _, server := range s.Servers {
+		if server.Serving {
+			serving++
+		}
+	}
+	return serving
+}
+
+// Leader returns address of leader or empty string
+func (s *EnsembleStatus) Leader() string {
+	for _, server := range s.Servers {
+		if server.Mode == ModeLeader {
+			return server.Address
+		}
+	}
+	return ""
+}
+
+// HasQuorum returns true if majority of voting servers serve requests, observers do not vote
+// and servers which did not report their mode are counted as voting
+func (s *EnsembleStatus) HasQuorum() bool {
+	voting, serving := 0, 0
+	for _, server := range s.Servers {
+		if server.Mode == ModeStandalone && server.Serving {
+			return true
+		}
+		if server.Mode == ModeObserver {
+			continue
+		}
+		voting++
+		if server.Serving {
+			serving++
+		}
+	}
+	return voting > 0 && serving*2 > voting
+}
+
+// Error returns error when none of servers could be reached
+func (s *EnsembleStatus) Error() error {
+	if len(s.Servers) == 0 {
+		return fmt.Errorf("no zookeeper servers to check")
+	}
+	if s.Reachable() > 0 {
+		return nil
+	}
+	errs := []string{}
+	for _, server := range s.Servers {
+		errs = append(errs, server.Error.Error())
+	}
+	return fmt.Errorf("zookeeper servers are unreachable: %s", strings.Join(errs, "; "))
+}
+
+// String returns short summary of ensemble state
+func (s *EnsembleStatus) String() string {
+	summary := fmt.Sprintf("%d/%d servers serving", s.Serving(), len(s.Servers))
+	if leader := s.Leader(); len(leader) > 0 {
+		summary += ", leader " + leader
+	}
+	return summary
+}
+
+// tlsConfigForServer sets ServerName of TLS config from server address
+func tlsConfigForServer(config *tls.Config, server string) *tls.Config {
+	if len(config.ServerName) > 0 || config.InsecureSkipVerify {
+		return config
+	}
+	serverConfig := config.Clone()
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		serverConfig.ServerName = host
+	} else {
+		serverConfig.ServerName = server
+	}
+	return serverConfig
+}
@@ -0,0 +1,282 @@
+package zookeeper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const srvrLeader = `Zookeeper version: 3.5.6-c11b7e26bc554b8523dc929761dd28808913f091, built on 10/08/2019 20:18 GMT
+Latency min/avg/max: 0/0/12
+Received: 205
+Sent: 204
+Connections: 2
+Outstanding: 0
+Zxid: 0x100000004
+Mode: leader
+Node count: 5
+Proposal sizes last/min/max: 48/48/92
+`
+
+const mntrLeader = "zk_version\t3.5.6-c11b7e26bc554b8523dc929761dd28808913f091, built on 10/08/2019 20:18 GMT\n" +
+	"zk_avg_latency\t0\n" +
+	"zk_server_state\tleader\n" +
+	"zk_znode_count\t5\n" +
+	"zk_followers\t2\n" +
+	"zk_synced_followers\t2\n" +
+	"zk_pending_syncs\t0\n"
+
+func TestParseSrvr(t *testing.T) {
+	tests := []struct {
+		name     string
+		ok       bool
+		resp     string
+		expected ServerStatus
+	}{
+		{
+			name:     "leader",
+			ok:       true,
+			resp:     srvrLeader,
+			expected: ServerStatus{Ok: true, Serving: true, Mode: ModeLeader},
+		},
+		{
+			name:     "follower",
+			ok:       true,
+			resp:     strings.Replace(srvrLeader, "Mode: leader", "Mode: follower", 1),
+			expected: ServerStatus{Ok: true, Serving: true, Mode: ModeFollower},
+		},
+		{
+			name:     "observer",
+			ok:       true,
+			resp:     strings.Replace(srvrLeader, "Mode: leader", "Mode: observer", 1),
+			expected: ServerStatus{Ok: true, Serving: true, Mode: ModeObserver},
+		},
+		{
+			name:     "standalone",
+			ok:       true,
+			resp:     strings.Replace(srvrLeader, "Mode: leader", "Mode: standalone", 1),
+			expected: ServerStatus{Ok: true, Serving: true, Mode: ModeStandalone},
+		},
+		{
+			name:     "not serving",
+			ok:       true,
+			resp:     "This ZooKeeper instance is not currently serving requests\n",
+			expected: ServerStatus{Ok: true},
+		},
+		{
+			name:     "not whitelisted",
+			ok:       true,
+			resp:     "srvr is not executed because it is not in the whitelist.\n",
+			expected: ServerStatus{Ok: true, Serving: true},
+		},
+		{
+			name:     "not whitelisted and not ok",
+			resp:     "srvr is not executed because it is not in the whitelist.\n",
+			expected: ServerStatus{},
+		},
+		{
+			name:     "truncated",
+			ok:       true,
+			resp:     srvrLeader[:strings.Index(srvrLeader, "Mode:")],
+			expected: ServerStatus{Ok: true, Serving: true},
+		},
+		{
+			name:     "empty",
+			expected: ServerStatus{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := ServerStatus{Ok: test.ok}
+			parseSrvr(test.resp, &status)
+			if !reflect.DeepEqual(status, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, status)
+			}
+		})
+	}
+}
+
+func TestParseMntr(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     string
+		expected ServerStatus
+	}{
+		{
+			name:     "leader",
+			resp:     mntrLeader,
+			expected: ServerStatus{Mode: ModeLeader, SyncedFollowers: 2},
+		},
+		{
+			name:     "follower",
+			resp:     "zk_avg_latency\t0\nzk_server_state\tfollower\nzk_znode_count\t5\n",
+			expected: ServerStatus{Mode: ModeFollower},
+		},
+		{
+			name:     "observer",
+			resp:     "zk_server_state\tobserver\n",
+			expected: ServerStatus{Mode: ModeObserver},
+		},
+		{
+			name:     "malformed",
+			resp:     "zk_server_state\nzk_synced_followers\ttwo\nzk_server_state leader follower\n",
+			expected: ServerStatus{Mode: ModeFollower},
+		},
+		{
+			name:     "not whitelisted",
+			resp:     "mntr is not executed because it is not in the whitelist.\n",
+			expected: ServerStatus{Mode: ModeFollower},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Mode reported by srvr is kept when mntr does not report it
+			status := ServerStatus{Mode: ModeFollower}
+			parseMntr(test.resp, &status)
+			if !reflect.DeepEqual(status, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, status)
+			}
+		})
+	}
+}
+
+func TestHasQuorum(t *testing.T) {
+	leader := ServerStatus{Ok: true, Serving: true, Mode: ModeLeader}
+	follower := ServerStatus{Ok: true, Serving: true, Mode: ModeFollower}
+	observer := ServerStatus{Ok: true, Serving: true, Mode: ModeObserver}
+	notServing := ServerStatus{Ok: true}
+	unreachable := ServerStatus{Error: errors.New("connection refused")}
+
+	tests := []struct {
+		name     string
+		servers  []ServerStatus
+		expected bool
+	}{
+		{name: "no servers", expected: false},
+		{name: "standalone", servers: []ServerStatus{{Ok: true, Serving: true, Mode: ModeStandalone}}, expected: true},
+		{name: "standalone not serving", servers: []ServerStatus{{Ok: true, Mode: ModeStandalone}}, expected: false},
+		{name: "all serving", servers: []ServerStatus{leader, follower, follower}, expected: true},
+		{name: "majority serving", servers: []ServerStatus{leader, follower, unreachable}, expected: true},
+		{name: "minority serving", servers: []ServerStatus{follower, notServing, unreachable}, expected: false},
+		{name: "half serving", servers: []ServerStatus{leader, follower, unreachable, unreachable}, expected: false},
+		{name: "observers do not vote", servers: []ServerStatus{leader, follower, unreachable, observer, observer}, expected: true},
+		{name: "observers do not make majority", servers: []ServerStatus{follower, unreachable, unreachable, observer, observer}, expected: false},
+		{name: "only observers", servers: []ServerStatus{observer}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := &EnsembleStatus{Servers: test.servers}
+			if quorum := status.HasQuorum(); quorum != test.expected {
+				t.Errorf("expected quorum %v of %+v, got %v", test.expected, test.servers, quorum)
+			}
+		})
+	}
+}
+
+// listen starts fake server, which answers four letter words by responses, unknown commands are not answered
+// until connection is closed by client
+func listen(t *testing.T, responses map[string]string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				command := make([]byte, 4)
+				if _, err := io.ReadFull(conn, command); err != nil {
+					return
+				}
+				resp, ok := responses[string(command)]
+				if !ok {
+					io.Copy(ioutil.Discard, conn)
+					return
+				}
+				io.WriteString(conn, resp)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestCheckServer(t *testing.T) {
+	listener := listen(t, map[string]string{"ruok": "imok", "srvr": srvrLeader, "mntr": mntrLeader})
+	defer listener.Close()
+	server := listener.Addr().String()
+	checker := NewChecker(time.Second, time.Second)
+
+	status := checker.CheckServer(context.Background(), server)
+	expected := ServerStatus{Address: server, Ok: true, Serving: true, Mode: ModeLeader, SyncedFollowers: 2}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got %+v", expected, status)
+	}
+}
+
+func TestFourLetterWordTimeout(t *testing.T) {
+	// Server accepts connection and never answers
+	listener := listen(t, nil)
+	defer listener.Close()
+	server := listener.Addr().String()
+
+	tests := []struct {
+		name        string
+		readTimeout time.Duration
+		ctx         func() (context.Context, context.CancelFunc)
+		check       func(err error) bool
+	}{
+		{
+			name:        "read timeout",
+			readTimeout: 50 * time.Millisecond,
+			ctx:         func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			check: func(err error) bool {
+				netErr, ok := err.(net.Error)
+				return ok && netErr.Timeout()
+			},
+		},
+		{
+			name:        "context deadline",
+			readTimeout: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			check: func(err error) bool { return err == context.DeadlineExceeded },
+		},
+		{
+			name:        "context cancel",
+			readTimeout: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			check: func(err error) bool { return err == context.Canceled },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := test.ctx()
+			defer cancel()
+			checker := NewChecker(time.Second, test.readTimeout)
+
+			start := time.Now()
+			resp, err := checker.FourLetterWord(ctx, server, "ruok")
+			if !test.check(err) {
+				t.Errorf("expected timeout, got response %q and error %v", resp, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected check to stop after 50ms, it took %s", elapsed)
+			}
+		})
+	}
+}
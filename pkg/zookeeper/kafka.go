@@ -0,0 +1,87 @@
+package zookeeper
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// MigrationState is content of /migration znode written by KRaft controller during migration
+type MigrationState struct {
+	ControllerID   int32 `json:"kraft_controller_id"`
+	MetadataOffset int64 `json:"kraft_metadata_offset"`
+}
+
+// Migrated returns true when metadata were copied from ZooKeeper to KRaft quorum
+func (s *MigrationState) Migrated() bool {
+	return s != nil && s.MetadataOffset >= 0
+}
+
+// GetClusterID returns ID of Kafka cluster registered under chroot
+func (c *Client) GetClusterID(chroot string) (string, error) {
+	data, _, err := c.conn.Get(path.Join("/", chroot, "cluster/id"))
+	if err != nil {
+		return "", fmt.Errorf("cannot read cluster id: %v", err)
+	}
+	clusterID := struct {
+		ID string `json:"id"`
+	}{}
+	if err = json.Unmarshal(data, &clusterID); err != nil {
+		return "", fmt.Errorf("cannot parse cluster id: %v", err)
+	}
+	return clusterID.ID, nil
+}
+
+// GetMigrationState returns state of migration to KRaft or nil when migration did not start yet
+func (c *Client) GetMigrationState(chroot string) (*MigrationState, error) {
+	data, _, err := c.conn.Get(path.Join("/", chroot, "migration"))
+	if err == zk.ErrNoNode {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read migration state: %v", err)
+	}
+	state := &MigrationState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("cannot parse migration state: %v", err)
+	}
+	return state, nil
+}
+
+// GetControllerID returns ID of active controller registered in /controller znode or -1
+func (c *Client) GetControllerID(chroot string) (int32, error) {
+	data, _, err := c.conn.Get(path.Join("/", chroot, "controller"))
+	if err == zk.ErrNoNode {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("cannot read controller: %v", err)
+	}
+	controller := struct {
+		BrokerID int32 `json:"brokerid"`
+	}{}
+	if err = json.Unmarshal(data, &controller); err != nil {
+		return -1, fmt.Errorf("cannot parse controller: %v", err)
+	}
+	return controller.BrokerID, nil
+}
+
+// DeleteMigrationState deletes /migration znode, so next migration copies metadata from ZooKeeper again
+func (c *Client) DeleteMigrationState(chroot string) error {
+	err := c.conn.Delete(path.Join("/", chroot, "migration"), -1)
+	if err != nil && err != zk.ErrNoNode {
+		return fmt.Errorf("cannot delete migration state: %v", err)
+	}
+	return nil
+}
+
+// DeleteController deletes /controller znode, so brokers elect new controller among themselves
+func (c *Client) DeleteController(chroot string) error {
+	err := c.conn.Delete(path.Join("/", chroot, "controller"), -1)
+	if err != nil && err != zk.ErrNoNode {
+		return fmt.Errorf("cannot delete controller: %v", err)
+	}
+	return nil
+}
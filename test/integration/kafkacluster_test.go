@@ -0,0 +1,142 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	litekafkav1alpha1 "github.com/Svimba/lite-kafka-operator/pkg/apis/litekafka/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	pollInterval = 200 * time.Millisecond
+	pollTimeout  = 30 * time.Second
+)
+
+// createKafkaCluster creates namespace and cluster in it, zookeeper check is disabled as there is no zookeeper
+func createKafkaCluster(t *testing.T, name string, replicas int32) *litekafkav1alpha1.KafkaCluster {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", name, time.Now().UnixNano())}}
+	if err := k8sClient.Create(context.TODO(), namespace); err != nil {
+		t.Fatal(err)
+	}
+	zookeeperCheck := false
+	kafka := &litekafkav1alpha1.KafkaCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace.Name},
+		Spec: litekafkav1alpha1.KafkaClusterSpec{
+			Replicas:       replicas,
+			ZookeeperCheck: &zookeeperCheck,
+		},
+	}
+	if err := k8sClient.Create(context.TODO(), kafka); err != nil {
+		t.Fatal(err)
+	}
+	return kafka
+}
+
+// waitFor polls object until condition returns true
+func waitFor(t *testing.T, name, namespace string, obj runtime.Object, condition func() bool) {
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		if err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, obj); err != nil {
+			return false, nil
+		}
+		return condition(), nil
+	})
+	if err != nil {
+		t.Fatalf("%s/%s did not reach expected state: %v, last state: %+v", namespace, name, err, obj)
+	}
+}
+
+// updateKafkaCluster changes spec of latest cluster, operator updates status concurrently, so conflicts are retried
+func updateKafkaCluster(t *testing.T, kafka *litekafkav1alpha1.KafkaCluster, change func()) {
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		if err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: kafka.Name, Namespace: kafka.Namespace}, kafka); err != nil {
+			return false, err
+		}
+		change()
+		return k8sClient.Update(context.TODO(), kafka) == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("cannot update KafkaCluster %s/%s: %v", kafka.Namespace, kafka.Name, err)
+	}
+}
+
+func waitForReplicas(t *testing.T, kafka *litekafkav1alpha1.KafkaCluster, replicas int32) *appsv1.StatefulSet {
+	sts := &appsv1.StatefulSet{}
+	waitFor(t, kafka.Name+"-kafka", kafka.Namespace, sts, func() bool {
+		return sts.Spec.Replicas != nil && *sts.Spec.Replicas == replicas
+	})
+	return sts
+}
+
+func TestKafkaClusterResources(t *testing.T) {
+	kafka := createKafkaCluster(t, "resources", 3)
+	sts := waitForReplicas(t, kafka, 3)
+
+	owned := []struct {
+		name string
+		obj  metav1.Object
+	}{
+		{kafka.Name + "-kafka", sts},
+		{kafka.Name + "-kafka", &corev1.Service{}},
+		{kafka.Name + "-kafka-headless", &corev1.Service{}},
+		{kafka.Name + "-kafka", &policyv1beta1.PodDisruptionBudget{}},
+	}
+	for _, o := range owned {
+		waitFor(t, o.name, kafka.Namespace, o.obj.(runtime.Object), func() bool { return true })
+		// Garbage collector deletes objects with owner reference to deleted KafkaCluster
+		refs := o.obj.GetOwnerReferences()
+		if len(refs) != 1 || refs[0].UID != kafka.UID || refs[0].Kind != "KafkaCluster" ||
+			refs[0].Controller == nil || !*refs[0].Controller || refs[0].BlockOwnerDeletion == nil || !*refs[0].BlockOwnerDeletion {
+			t.Errorf("%T %s is not controlled by KafkaCluster %s: %+v", o.obj, o.name, kafka.UID, refs)
+		}
+	}
+}
+
+func TestKafkaClusterScale(t *testing.T) {
+	kafka := createKafkaCluster(t, "scale", 3)
+	waitForReplicas(t, kafka, 3)
+
+	for _, replicas := range []int32{5, 1} {
+		updateKafkaCluster(t, kafka, func() { kafka.Spec.Replicas = replicas })
+		waitForReplicas(t, kafka, replicas)
+	}
+}
+
+func TestKafkaClusterStatus(t *testing.T) {
+	kafka := createKafkaCluster(t, "status", 1)
+
+	waitFor(t, kafka.Name, kafka.Namespace, kafka, func() bool {
+		return kafka.Status.Mode == litekafkav1alpha1.ModeZookeeper
+	})
+	// Status is written through subresource, spec and generation are not changed by operator
+	if kafka.Generation != 1 {
+		t.Errorf("expected generation 1, got %d", kafka.Generation)
+	}
+	if kafka.Spec.Replicas != 1 || kafka.Spec.Zookeeper != nil {
+		t.Errorf("spec is changed by operator: %+v", kafka.Spec)
+	}
+
+	// Update of spec does not reset status
+	updateKafkaCluster(t, kafka, func() { kafka.Spec.Image = "confluentinc/cp-kafka:5.3.1" })
+	sts := &appsv1.StatefulSet{}
+	waitFor(t, kafka.Name+"-kafka", kafka.Namespace, sts, func() bool {
+		return sts.Spec.Template.Spec.Containers[0].Image == kafka.Spec.Image
+	})
+	if err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: kafka.Name, Namespace: kafka.Namespace}, kafka); err != nil {
+		t.Fatal(err)
+	}
+	if kafka.Status.Mode != litekafkav1alpha1.ModeZookeeper {
+		t.Errorf("status is lost after update of spec: %+v", kafka.Status)
+	}
+}
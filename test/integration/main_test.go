@@ -0,0 +1,87 @@
+//go:build integration
+// +build integration
+
+// Package integration runs operator against kube-apiserver and etcd started by envtest.
+// Binaries are taken from KUBEBUILDER_ASSETS or /usr/local/kubebuilder/bin, make downloads them:
+//
+//	make test-integration
+//
+// Suite fails when binaries are missing, SKIP_INTEGRATION_TESTS=true skips it instead.
+//
+// envtest does not run kube-controller-manager, so pods of StatefulSets are not created
+// and objects are not garbage collected, tests check owner references garbage collector relies on.
+package integration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Svimba/lite-kafka-operator/pkg/controller"
+	"github.com/Svimba/lite-kafka-operator/pkg/controller/kafkacluster"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// k8sClient reads objects directly from apiserver, it is not affected by cache of manager
+var k8sClient client.Client
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	assets := os.Getenv("KUBEBUILDER_ASSETS")
+	if len(assets) == 0 {
+		assets = "/usr/local/kubebuilder/bin"
+	}
+	if _, err := os.Stat(filepath.Join(assets, "kube-apiserver")); err != nil {
+		// Missing binaries must not look like passed tests in CI
+		if os.Getenv("SKIP_INTEGRATION_TESTS") == "true" {
+			fmt.Printf("Skipping integration tests, kube-apiserver is not found in %s\n", assets)
+			return 0
+		}
+		fmt.Printf("Cannot run integration tests, kube-apiserver is not found in %s, run make integration-assets "+
+			"or set SKIP_INTEGRATION_TESTS=true\n", assets)
+		return 1
+	}
+	logf.SetLogger(logf.ZapLogger(true))
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths: []string{filepath.Join("..", "..", "deploy", "crds")},
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		fmt.Printf("Cannot start envtest: %v\n", err)
+		return 1
+	}
+	defer env.Stop()
+
+	// Manager is set up by the same function as in cmd/manager, zookeeper and brokers are not available in tests
+	if err = kafkacluster.FlagSet().Parse([]string{"--health-check-interval=0"}); err != nil {
+		fmt.Printf("Cannot set options of controller: %v\n", err)
+		return 1
+	}
+	mgr, err := controller.NewManager(cfg, manager.Options{MetricsBindAddress: "0"})
+	if err != nil {
+		fmt.Printf("Cannot create manager: %v\n", err)
+		return 1
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		if err := mgr.Start(stop); err != nil {
+			fmt.Printf("Manager exited: %v\n", err)
+		}
+	}()
+
+	k8sClient, err = client.New(cfg, client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		fmt.Printf("Cannot create client: %v\n", err)
+		return 1
+	}
+	return m.Run()
+}